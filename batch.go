@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	TextFormat = "text"
+	CSVFormat  = "csv"
+	JSONFormat = "json"
+)
+
+// Formats contains the output formats supported by batch mode.
+var Formats = []string{TextFormat, CSVFormat, JSONFormat}
+
+// Batch prints snapshots of a Monitor's processes to a writer instead of
+// drawing them with termbox.
+type Batch struct {
+	monitor *Monitor
+	w       *bufio.Writer
+	csv     *csv.Writer
+	format  string
+
+	wroteHeader bool
+}
+
+// NewBatch returns a Batch that writes snapshots of monitor in format to w.
+func NewBatch(monitor *Monitor, w io.Writer, format string) *Batch {
+	b := &Batch{
+		monitor: monitor,
+		w:       bufio.NewWriter(w),
+		format:  format,
+	}
+	b.csv = csv.NewWriter(b.w)
+	return b
+}
+
+// Run updates the Monitor every delay and prints a snapshot after each
+// update. It stops after iterations snapshots, or never if iterations is 0.
+func (b *Batch) Run(delay time.Duration, iterations int) error {
+	ticker := time.NewTicker(delay)
+	defer ticker.Stop()
+
+	for i := 0; iterations == 0 || i < iterations; i++ {
+		// The Monitor was updated once already; wait a full delay so the
+		// CPU usage of the first snapshot covers a whole interval too.
+		<-ticker.C
+
+		// Only an abandoned update leaves nothing to print.
+		if err := b.monitor.Update(); err != nil {
+			return err
+		}
+		if err := b.Write(time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write prints the current state of the Monitor, taken at time t.
+func (b *Batch) Write(t time.Time) error {
+	switch b.format {
+	case CSVFormat:
+		b.writeCSV(t)
+	case JSONFormat:
+		if err := b.writeJSON(t); err != nil {
+			return err
+		}
+	default:
+		b.writeText(t)
+	}
+	return b.w.Flush()
+}
+
+func (b *Batch) writeText(t time.Time) {
+	if b.wroteHeader {
+		fmt.Fprintln(b.w)
+	}
+	b.wroteHeader = true
+
+	processes := b.monitor.Ordered()
+	fmt.Fprintf(b.w, "jtop - %s, %d processes\n", t.Format(time.RFC3339),
+		len(processes))
+
+	titles := make([]string, len(Columns))
+	for i, column := range Columns {
+		titles[i] = column.Title
+	}
+	b.writeTextRow(titles, "")
+
+	for _, process := range processes {
+		values := make([]string, len(Columns))
+		for i, column := range Columns {
+			values[i] = column.Format(b.monitor, process)
+			if column.Width > 0 {
+				values[i] = runewidth.Truncate(values[i], column.Width, "+")
+			}
+		}
+		prefix := ""
+		if treeFlag {
+			prefix = process.TreePrefix
+		}
+		b.writeTextRow(values, prefix)
+	}
+}
+
+// writeTextRow writes values padded to the width of their columns. The
+// prefix is written in front of the COMMAND column.
+func (b *Batch) writeTextRow(values []string, prefix string) {
+	var line strings.Builder
+	for i, column := range Columns {
+		value := values[i]
+		if column == CommandColumn {
+			value = prefix + value
+		}
+		padding := ""
+		if width := runewidth.StringWidth(value); width < column.Width {
+			padding = strings.Repeat(" ", column.Width-width)
+		}
+		if column.RightAlign {
+			line.WriteString(padding + value)
+		} else {
+			line.WriteString(value + padding)
+		}
+		if i < len(Columns)-1 {
+			line.WriteByte(' ')
+		}
+	}
+	fmt.Fprintln(b.w, strings.TrimRight(line.String(), " "))
+}
+
+func (b *Batch) writeCSV(t time.Time) {
+	if !b.wroteHeader {
+		record := []string{"TIME"}
+		for _, column := range Columns {
+			record = append(record, column.Title)
+		}
+		b.csv.Write(record)
+		b.wroteHeader = true
+	}
+
+	timestamp := t.Format(time.RFC3339)
+	for _, process := range b.monitor.Ordered() {
+		record := []string{timestamp}
+		for _, column := range Columns {
+			record = append(record, column.Format(b.monitor, process))
+		}
+		b.csv.Write(record)
+	}
+	b.csv.Flush()
+}
+
+// writeJSON writes the snapshot as a single line so that the output of
+// several iterations can be read as a stream of JSON objects.
+func (b *Batch) writeJSON(t time.Time) error {
+	processes := make([]map[string]string, 0, len(b.monitor.List))
+	for _, process := range b.monitor.Ordered() {
+		values := make(map[string]string, len(Columns))
+		for _, column := range Columns {
+			values[column.Title] = column.Format(b.monitor, process)
+		}
+		processes = append(processes, values)
+	}
+
+	snapshot := struct {
+		Time      time.Time           `json:"time"`
+		Processes []map[string]string `json:"processes"`
+	}{t, processes}
+
+	return json.NewEncoder(b.w).Encode(snapshot)
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// A Column of the process list. Columns describe how their values are
+// formatted and sorted, so a new metric only needs a definition here.
+type Column struct {
+	Title string
+
+	// Width is the number of cells of the column, -1 for the rest of the
+	// line.
+	Width      int
+	RightAlign bool
+
+	// Description is shown in the column chooser.
+	Description string
+
+	// Format returns the text displayed for a process.
+	Format func(m *Monitor, p *Process) string
+
+	// Compare returns a negative number if p1 comes before p2 when sorting
+	// by the column, a positive number if it comes after and 0 if they're
+	// equal. Numbers sort in descending order except for IDs and
+	// priorities, text in ascending order.
+	Compare func(p1, p2 *Process) int
+}
+
+var (
+	PidColumn = &Column{
+		Title: "PID", Width: 5, RightAlign: true,
+		Description: "process ID",
+		Format: func(m *Monitor, p *Process) string {
+			return strconv.FormatUint(p.Pid, 10)
+		},
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p1.Pid, p2.Pid)
+		},
+	}
+
+	UserColumn = &Column{
+		Title: "USER", Width: 8,
+		Description: "user name of the owner",
+		Format: func(m *Monitor, p *Process) string {
+			return p.User.Username
+		},
+		Compare: func(p1, p2 *Process) int {
+			return strings.Compare(p1.User.Username, p2.User.Username)
+		},
+	}
+
+	PriorityColumn = &Column{
+		Title: "PRI", Width: 3, RightAlign: true,
+		Description: "kernel scheduling priority, rt for real-time",
+		Format: func(m *Monitor, p *Process) string {
+			if p.Priority < -99 {
+				// Real-time processes with the highest priority, like top.
+				return "rt"
+			}
+			return strconv.FormatInt(p.Priority, 10)
+		},
+		Compare: func(p1, p2 *Process) int {
+			return compareInt64(p1.Priority, p2.Priority)
+		},
+	}
+
+	NiceColumn = &Column{
+		Title: "NI", Width: 3, RightAlign: true,
+		Description: "nice value, from -20 to 19",
+		Format: func(m *Monitor, p *Process) string {
+			return strconv.FormatInt(p.Nice, 10)
+		},
+		Compare: func(p1, p2 *Process) int {
+			return compareInt64(p1.Nice, p2.Nice)
+		},
+	}
+
+	RSSColumn = &Column{
+		Title: "RSS", Width: 5, RightAlign: true,
+		Description: "resident memory",
+		Format: func(m *Monitor, p *Process) string {
+			return formatMemory(p.RSS * m.PageSize)
+		},
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.RSS, p1.RSS)
+		},
+	}
+
+	MemPercentColumn = &Column{
+		Title: "%MEM", Width: 5, RightAlign: true,
+		Description: "resident memory as a share of total memory",
+		Format: func(m *Monitor, p *Process) string {
+			return fmt.Sprintf("%.1f", m.MemPercent(p))
+		},
+		Compare: RSSColumn.Compare,
+	}
+
+	PSSColumn = &Column{
+		Title: "PSS", Width: 5, RightAlign: true,
+		Description: "resident memory with shared pages split among sharers",
+		Format:      smapsFormat(func(p *Process) uint64 { return p.PSS }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.PSS, p1.PSS)
+		},
+	}
+
+	USSColumn = &Column{
+		Title: "USS", Width: 5, RightAlign: true,
+		Description: "resident memory not shared with other processes",
+		Format:      smapsFormat(func(p *Process) uint64 { return p.USS }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.USS, p1.USS)
+		},
+	}
+
+	SwapColumn = &Column{
+		Title: "SWAP", Width: 5, RightAlign: true,
+		Description: "swapped out memory",
+		Format:      smapsFormat(func(p *Process) uint64 { return p.Swap }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.Swap, p1.Swap)
+		},
+	}
+
+	SwapPSSColumn = &Column{
+		Title: "SWAPPSS", Width: 7, RightAlign: true,
+		Description: "swapped out memory with shared pages split among sharers",
+		Format:      smapsFormat(func(p *Process) uint64 { return p.SwapPSS }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.SwapPSS, p1.SwapPSS)
+		},
+	}
+
+	CPUPercentColumn = &Column{
+		Title: "%CPU", Width: 5, RightAlign: true,
+		Description: "CPU usage since the last update, 100 is one CPU",
+		Format: func(m *Monitor, p *Process) string {
+			return fmt.Sprintf("%.1f", m.CPUPercent(p))
+		},
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.UtimeDiff+p2.StimeDiff, p1.UtimeDiff+p1.StimeDiff)
+		},
+	}
+
+	CPUTimeColumn = &Column{
+		Title: "TIME+", Width: 9, RightAlign: true,
+		Description: "CPU time used, in minutes, seconds and hundredths",
+		Format: func(m *Monitor, p *Process) string {
+			hertz := uint64(100)
+			// TODO: this has only been tested on my Ubuntu 14.04 system that has
+			// a CLK_TCK of 100. Test on other configurations. (getconf CLK_TCK)
+			totalJiffies := p.Utime + p.Stime
+			totalSeconds := totalJiffies / hertz
+
+			minutes := totalSeconds / 60
+			seconds := totalSeconds % 60
+			hundredths := totalJiffies % hertz
+
+			// FIXME: this won't be pretty when minutes gets big, maybe format hours?
+			return fmt.Sprintf("%d:%02d:%02d", minutes, seconds, hundredths)
+		},
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.Utime+p2.Stime, p1.Utime+p1.Stime)
+		},
+	}
+
+	IOReadColumn = &Column{
+		Title: "IO_R/s", Width: 6, RightAlign: true,
+		Description: "bytes read from storage per second",
+		Format:      ioFormat(func(p *Process) uint64 { return p.ReadBytesDiff }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.ReadBytesDiff, p1.ReadBytesDiff)
+		},
+	}
+
+	IOWriteColumn = &Column{
+		Title: "IO_W/s", Width: 6, RightAlign: true,
+		Description: "bytes written to storage per second",
+		Format:      ioFormat(func(p *Process) uint64 { return p.WriteBytesDiff }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.WriteBytesDiff, p1.WriteBytesDiff)
+		},
+	}
+
+	FDSColumn = &Column{
+		Title: "FDS", Width: 5, RightAlign: true,
+		Description: "open file descriptors",
+		Format: func(m *Monitor, p *Process) string {
+			if !p.FDsAvailable {
+				return "-"
+			}
+			return strconv.FormatUint(p.FDs, 10)
+		},
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.FDs, p1.FDs)
+		},
+	}
+
+	EstablishedColumn = &Column{
+		Title: "ESTAB", Width: 5, RightAlign: true,
+		Description: "established TCP and connected UDP sockets",
+		Format:      socketsFormat(func(p *Process) uint64 { return p.Established }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.Established, p1.Established)
+		},
+	}
+
+	ListeningColumn = &Column{
+		Title: "LISTEN", Width: 6, RightAlign: true,
+		Description: "listening TCP sockets",
+		Format:      socketsFormat(func(p *Process) uint64 { return p.Listening }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.Listening, p1.Listening)
+		},
+	}
+
+	NetRxColumn = &Column{
+		Title: "NET_RX/s", Width: 8, RightAlign: true,
+		Description: "bytes received per second by the network namespace",
+		Format:      trafficFormat(func(p *Process) uint64 { return p.NetRxBytesDiff }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.NetRxBytesDiff, p1.NetRxBytesDiff)
+		},
+	}
+
+	NetTxColumn = &Column{
+		Title: "NET_TX/s", Width: 8, RightAlign: true,
+		Description: "bytes sent per second by the network namespace",
+		Format:      trafficFormat(func(p *Process) uint64 { return p.NetTxBytesDiff }),
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(p2.NetTxBytesDiff, p1.NetTxBytesDiff)
+		},
+	}
+
+	StateColumn = &Column{
+		Title: "S", Width: 1,
+		Description: "state, see Process states in the help",
+		Format: func(m *Monitor, p *Process) string {
+			return string(p.State)
+		},
+		Compare: func(p1, p2 *Process) int {
+			return compareUint64(uint64(p1.State), uint64(p2.State))
+		},
+	}
+
+	CommandColumn = &Column{
+		Title: "COMMAND", Width: -1,
+		Description: "command name, or command line with --verbose",
+		Format: func(m *Monitor, p *Process) string {
+			if verboseFlag {
+				return p.Command
+			}
+			return p.Name
+		},
+		Compare: func(p1, p2 *Process) int {
+			return strings.Compare(p1.Name, p2.Name)
+		},
+	}
+
+	// AllColumns are all the columns in their default order.
+	AllColumns = []*Column{
+		PidColumn,
+		UserColumn,
+		PriorityColumn,
+		NiceColumn,
+		RSSColumn,
+		MemPercentColumn,
+		PSSColumn,
+		USSColumn,
+		SwapColumn,
+		SwapPSSColumn,
+		CPUPercentColumn,
+		CPUTimeColumn,
+		IOReadColumn,
+		IOWriteColumn,
+		FDSColumn,
+		EstablishedColumn,
+		ListeningColumn,
+		NetRxColumn,
+		NetTxColumn,
+		StateColumn,
+		CommandColumn,
+	}
+
+	// Columns are the columns that are shown, in order.
+	Columns = []*Column{
+		PidColumn,
+		UserColumn,
+		PriorityColumn,
+		NiceColumn,
+		RSSColumn,
+		MemPercentColumn,
+		CPUPercentColumn,
+		CPUTimeColumn,
+		IOReadColumn,
+		IOWriteColumn,
+		StateColumn,
+		CommandColumn,
+	}
+
+	// SmapsColumns are added after MemPercentColumn by the --smaps option.
+	SmapsColumns = []*Column{
+		PSSColumn,
+		USSColumn,
+		SwapColumn,
+		SwapPSSColumn,
+	}
+
+	// NetColumns need the sockets and network namespaces of every process.
+	NetColumns = []*Column{
+		EstablishedColumn,
+		ListeningColumn,
+		NetRxColumn,
+		NetTxColumn,
+	}
+)
+
+// smapsFormat returns a Format function for a field read from
+// smaps_rollup.
+func smapsFormat(field func(p *Process) uint64) func(m *Monitor, p *Process) string {
+	return func(m *Monitor, p *Process) string {
+		if !p.SmapsAvailable {
+			return "-"
+		}
+		return formatMemory(field(p))
+	}
+}
+
+// ioFormat returns a Format function for the rate of an I/O counter.
+func ioFormat(diff func(p *Process) uint64) func(m *Monitor, p *Process) string {
+	return func(m *Monitor, p *Process) string {
+		if !p.IOAvailable {
+			return "-"
+		}
+		return formatBytes(uint64(m.Rate(diff(p))))
+	}
+}
+
+// socketsFormat returns a Format function for a count of sockets.
+func socketsFormat(count func(p *Process) uint64) func(m *Monitor, p *Process) string {
+	return func(m *Monitor, p *Process) string {
+		if !p.SocketsAvailable {
+			return "-"
+		}
+		return strconv.FormatUint(count(p), 10)
+	}
+}
+
+// trafficFormat returns a Format function for the rate of a network
+// namespace counter.
+func trafficFormat(diff func(p *Process) uint64) func(m *Monitor, p *Process) string {
+	return func(m *Monitor, p *Process) string {
+		if !p.TrafficAvailable {
+			return "-"
+		}
+		return formatBytes(uint64(m.Rate(diff(p))))
+	}
+}
+
+// ColumnByTitle returns the column with title, or nil if there isn't one.
+func ColumnByTitle(title string) *Column {
+	for _, column := range AllColumns {
+		if column.Title == title {
+			return column
+		}
+	}
+	return nil
+}
+
+// columnShown returns whether column is in Columns.
+func columnShown(column *Column) bool {
+	for _, shown := range Columns {
+		if shown == column {
+			return true
+		}
+	}
+	return false
+}
+
+// smapsShown returns whether any of the SmapsColumns is shown.
+func smapsShown() bool {
+	for _, column := range SmapsColumns {
+		if columnShown(column) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnUsed returns whether column is shown or sorted by, so that its
+// values need to be read.
+func columnUsed(column *Column) bool {
+	return columnShown(column) || column.Title == sortFlag || column.Title == SecondarySort
+}
+
+// anyColumnUsed returns whether any of columns is used, like the
+// SmapsColumns that all need smaps_rollup.
+func anyColumnUsed(columns []*Column) bool {
+	for _, column := range columns {
+		if columnUsed(column) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// SortReverse inverts the order of the sort column.
+	SortReverse bool
+
+	// SecondarySort is the title of the column that orders the processes
+	// that are equal in the sort column, if any.
+	SecondarySort string
+)
+
+// BySort sorts processes by a column, then by a secondary column if it's
+// set and finally by Pid.
+type BySort struct {
+	List      []*Process
+	Column    *Column
+	Reverse   bool
+	Secondary *Column
+}
+
+func (p BySort) Len() int      { return len(p.List) }
+func (p BySort) Swap(i, j int) { p.List[i], p.List[j] = p.List[j], p.List[i] }
+func (p BySort) Less(i, j int) bool {
+	p1, p2 := p.List[i], p.List[j]
+	var c int
+	if p.Column != nil {
+		c = p.Column.Compare(p1, p2)
+		if p.Reverse {
+			c = -c
+		}
+	}
+	if c == 0 && p.Secondary != nil {
+		c = p.Secondary.Compare(p1, p2)
+	}
+	if c == 0 {
+		return p1.Pid < p2.Pid
+	}
+	return c < 0
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// columnChooser is a Dialog to show, hide and reorder the columns. The
+// COMMAND column takes the rest of the line, so it stays last.
+type columnChooser struct {
+	// columns are the shown Columns followed by the hidden ones.
+	columns  []*Column
+	shown    map[*Column]bool
+	selected int
+}
+
+// HandleColumns opens the column chooser.
+func (ui *UI) HandleColumns() {
+	chooser := &columnChooser{shown: make(map[*Column]bool)}
+	for _, column := range Columns {
+		if column != CommandColumn {
+			chooser.columns = append(chooser.columns, column)
+			chooser.shown[column] = true
+		}
+	}
+	for _, column := range AllColumns {
+		if !chooser.shown[column] && column != CommandColumn {
+			chooser.columns = append(chooser.columns, column)
+		}
+	}
+	ui.OpenDialog(chooser)
+}
+
+func (chooser *columnChooser) Draw(ui *UI) {
+	const width = 72
+	height := len(chooser.columns) + 4
+	x, y := 2, ui.headerRows()
+
+	ui.unscrolled(func() {
+		ui.drawBox(x, y, width, height, "Columns")
+		ui.writeBoxLine(x, width, "space: show/hide  J/K: move  esc: done")
+		ui.writeBoxLine(x, width, "")
+		for i, column := range chooser.columns {
+			mark := ' '
+			if chooser.shown[column] {
+				mark = 'x'
+			}
+			line := fmt.Sprintf("[%c] %-8s %s", mark, column.Title, column.Description)
+			if i == chooser.selected {
+				ui.fg, ui.bg = selectedFG, selectedBG
+			}
+			ui.writeBoxLine(x, width, line)
+			ui.fg, ui.bg = dialogFG, dialogBG
+		}
+	})
+}
+
+func (chooser *columnChooser) HandleKey(ui *UI, ev termbox.Event) bool {
+	columns := chooser.columns
+	i := chooser.selected
+
+	switch {
+	case ev.Ch == 'q' || ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyEnter:
+		return false
+	case ev.Ch == 'j' || ev.Key == termbox.KeyArrowDown:
+		if i < len(columns)-1 {
+			chooser.selected++
+		}
+	case ev.Ch == 'k' || ev.Key == termbox.KeyArrowUp:
+		if i > 0 {
+			chooser.selected--
+		}
+	case ev.Ch == 'J':
+		if i < len(columns)-1 {
+			columns[i], columns[i+1] = columns[i+1], columns[i]
+			chooser.selected++
+		}
+	case ev.Ch == 'K':
+		if i > 0 {
+			columns[i], columns[i-1] = columns[i-1], columns[i]
+			chooser.selected--
+		}
+	case ev.Ch == ' ' || ev.Key == termbox.KeySpace:
+		chooser.shown[columns[i]] = !chooser.shown[columns[i]]
+	default:
+		return true
+	}
+
+	Columns = nil
+	for _, column := range columns {
+		if chooser.shown[column] {
+			Columns = append(Columns, column)
+		}
+	}
+	Columns = append(Columns, CommandColumn)
+	return true
+}
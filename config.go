@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A configSetting is a line of the configuration file.
+type configSetting struct {
+	key string
+
+	// flags are the options that override the setting.
+	flags []string
+
+	// set applies the value read from the file, get returns the current
+	// value to write back.
+	set func(value configValue) error
+	get func(m *Monitor) string
+}
+
+// configSettings are the settings of the configuration file, in the order
+// they're written. The file is a small subset of TOML, with the key
+// bindings of Actions in a [keys] table:
+//
+//	delay = "1.5s"
+//	sort = "%CPU"
+//	columns = ["PID", "USER", "RSS", "%CPU", "COMMAND"]
+//	tree = true
+//
+//	[keys]
+//	select-first = ["g g", "home"]
+//	quit = "Q"
+var configSettings = []configSetting{
+	{
+		key:   "delay",
+		flags: []string{"d", "delay"},
+		set: func(value configValue) error {
+			s, err := value.String()
+			if err != nil {
+				return err
+			}
+			delayFlag, err = time.ParseDuration(s)
+			return err
+		},
+		get: func(m *Monitor) string { return strconv.Quote(delayFlag.String()) },
+	},
+	{
+		key:   "sort",
+		flags: []string{"s", "sort"},
+		set:   func(value configValue) (err error) { sortFlag, err = value.String(); return },
+		get:   func(m *Monitor) string { return strconv.Quote(sortFlag) },
+	},
+	{
+		key: "reverse",
+		set: func(value configValue) (err error) { SortReverse, err = value.Bool(); return },
+		get: func(m *Monitor) string { return strconv.FormatBool(SortReverse) },
+	},
+	{
+		key: "then_by",
+		set: func(value configValue) error {
+			title, err := value.String()
+			if err != nil {
+				return err
+			}
+			if title != "" && ColumnByTitle(title) == nil {
+				return fmt.Errorf("%s is not a column", title)
+			}
+			SecondarySort = title
+			return nil
+		},
+		get: func(m *Monitor) string { return strconv.Quote(SecondarySort) },
+	},
+	{
+		key: "columns",
+		set: func(value configValue) error {
+			titles, err := value.List()
+			if err != nil {
+				return err
+			}
+			var columns []*Column
+			for _, title := range titles {
+				column := ColumnByTitle(title)
+				if column == nil {
+					return fmt.Errorf("%s is not a column", title)
+				}
+				if column != CommandColumn {
+					columns = append(columns, column)
+				}
+			}
+			// COMMAND takes the rest of the line, so it's always last.
+			Columns = append(columns, CommandColumn)
+			return nil
+		},
+		get: func(m *Monitor) string {
+			titles := make([]string, len(Columns))
+			for i, column := range Columns {
+				titles[i] = column.Title
+			}
+			return quoteList(titles)
+		},
+	},
+	{
+		key:   "theme",
+		flags: []string{"theme"},
+		set:   func(value configValue) (err error) { themeFlag, err = value.String(); return },
+		get:   func(m *Monitor) string { return strconv.Quote(themeFlag) },
+	},
+	{
+		key:   "filter",
+		flags: []string{"filter"},
+		set:   func(value configValue) (err error) { filterFlag, err = value.String(); return },
+		get: func(m *Monitor) string {
+			if m.Filter == nil {
+				return strconv.Quote("")
+			}
+			return strconv.Quote(m.Filter.String())
+		},
+	},
+	{
+		key:   "tree",
+		flags: []string{"t", "tree"},
+		set:   func(value configValue) (err error) { treeFlag, err = value.Bool(); return },
+		get:   func(m *Monitor) string { return strconv.FormatBool(treeFlag) },
+	},
+	{
+		key:   "verbose",
+		flags: []string{"verbose"},
+		set:   func(value configValue) (err error) { verboseFlag, err = value.Bool(); return },
+		get:   func(m *Monitor) string { return strconv.FormatBool(verboseFlag) },
+	},
+	{
+		key:   "kernel",
+		flags: []string{"k", "kernel"},
+		set:   func(value configValue) (err error) { kernelFlag, err = value.Bool(); return },
+		get:   func(m *Monitor) string { return strconv.FormatBool(kernelFlag) },
+	},
+	{
+		key:   "threads",
+		flags: []string{"H", "threads"},
+		set:   func(value configValue) (err error) { threadsFlag, err = value.Bool(); return },
+		get:   func(m *Monitor) string { return strconv.FormatBool(threadsFlag) },
+	},
+}
+
+// configValue is the text to the right of the = of a setting.
+type configValue string
+
+func (v configValue) String() (string, error) {
+	s := string(v)
+	if strings.HasPrefix(s, `"`) {
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+func (v configValue) Bool() (bool, error) {
+	return strconv.ParseBool(string(v))
+}
+
+// List parses an array of strings like ["PID", "USER"]. The items are
+// quoted, so they may contain commas.
+func (v configValue) List() ([]string, error) {
+	s := string(v)
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("expected a list like [\"a\", \"b\"]")
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+
+	var list []string
+	for s != "" {
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected a quoted string at %s", s)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+
+		s = strings.TrimSpace(s[len(quoted):])
+		if s != "" && !strings.HasPrefix(s, ",") {
+			return nil, fmt.Errorf("expected a comma before %s", s)
+		}
+		s = strings.TrimSpace(strings.TrimPrefix(s, ","))
+	}
+	return list, nil
+}
+
+// quoteList formats list as an array of strings like ["PID", "USER"].
+func quoteList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = strconv.Quote(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// bindKeys binds the key sequences in value, a string or a list of
+// strings, to the action called name in place of its current keys. An
+// empty list unbinds the action.
+func bindKeys(name string, value configValue) error {
+	action := FindAction(name)
+	if action == nil {
+		return fmt.Errorf("unknown action %q", name)
+	}
+
+	var keys []string
+	if strings.HasPrefix(string(value), "[") {
+		list, err := value.List()
+		if err != nil {
+			return err
+		}
+		keys = list
+	} else {
+		key, err := value.String()
+		if err != nil {
+			return err
+		}
+		keys = []string{key}
+	}
+
+	for _, sequence := range keys {
+		if err := validateKeySequence(sequence); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	action.Keys = keys
+	return nil
+}
+
+// defaultConfigPath returns $XDG_CONFIG_HOME/jtop/config, falling back to
+// ~/.config/jtop/config, or "" if neither is set.
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "jtop", "config")
+}
+
+// LoadConfig applies the settings of the configuration file at path,
+// except for those overridden by an option in given. It's not an error if
+// the file doesn't exist.
+func LoadConfig(path string, given map[string]bool) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var table string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			table = strings.TrimSpace(text[1 : len(text)-1])
+			if table != "keys" {
+				return fmt.Errorf("%s:%d: unknown table %q", path, line, table)
+			}
+			continue
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s:%d: expected key = value", path, line)
+		}
+		key := strings.TrimSpace(parts[0])
+		value := configValue(strings.TrimSpace(parts[1]))
+
+		if table == "keys" {
+			if err := bindKeys(key, value); err != nil {
+				return fmt.Errorf("%s:%d: %v", path, line, err)
+			}
+			continue
+		}
+
+		setting := findConfigSetting(key)
+		if setting == nil {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, line, key)
+		}
+		if overridden(setting.flags, given) {
+			continue
+		}
+		if err := setting.set(value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", path, line, key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := validateKeyBindings(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// SaveConfig writes the current settings to the configuration file at
+// path, creating its directory if needed.
+func SaveConfig(path string, m *Monitor) error {
+	if path == "" {
+		return fmt.Errorf("no configuration file, set --config")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# jtop configuration, options given on the command line override it.")
+	for _, setting := range configSettings {
+		fmt.Fprintf(&buf, "%s = %s\n", setting.key, setting.get(m))
+	}
+
+	// Only the bindings that differ from the defaults, so that new default
+	// bindings aren't hidden by an old file.
+	var keys []string
+	for _, action := range Actions {
+		if strings.Join(action.Keys, "\x00") != strings.Join(action.defaultKeys, "\x00") {
+			keys = append(keys, fmt.Sprintf("%s = %s", action.Name, quoteList(action.Keys)))
+		}
+	}
+	if len(keys) > 0 {
+		fmt.Fprintf(&buf, "\n[keys]\n%s\n", strings.Join(keys, "\n"))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// HandleSaveConfig writes the current settings to the configuration file.
+func (ui *UI) HandleSaveConfig() {
+	if err := SaveConfig(configFlag, ui.monitor); err != nil {
+		ui.SetError(err)
+		return
+	}
+	ui.SetMessage("wrote " + configFlag)
+}
+
+func findConfigSetting(key string) *configSetting {
+	for i := range configSettings {
+		if configSettings[i].key == key {
+			return &configSettings[i]
+		}
+	}
+	return nil
+}
+
+func overridden(flags []string, given map[string]bool) bool {
+	for _, name := range flags {
+		if given[name] {
+			return true
+		}
+	}
+	return false
+}
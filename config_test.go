@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigValueList(t *testing.T) {
+	tests := []struct {
+		value string
+		list  []string
+	}{
+		{`[]`, nil},
+		{`["PID", "USER"]`, []string{"PID", "USER"}},
+		{`[",", "g g",]`, []string{",", "g g"}},
+		{`["a, b" , "\""]`, []string{"a, b", `"`}},
+	}
+	for _, test := range tests {
+		list, err := configValue(test.value).List()
+		if err != nil {
+			t.Errorf("List(%s): %v", test.value, err)
+		} else if !reflect.DeepEqual(list, test.list) {
+			t.Errorf("List(%s) = %q, want %q", test.value, list, test.list)
+		}
+	}
+
+	for _, value := range []string{`PID`, `[PID]`, `["PID" "USER"]`, `["PID`} {
+		if _, err := configValue(value).List(); err == nil {
+			t.Errorf("List(%s) succeeded", value)
+		}
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	defer func() {
+		for _, action := range Actions {
+			action.Keys = action.defaultKeys
+		}
+	}()
+
+	// The default bindings plus one with the keys that need quoting.
+	previous := FindAction("replay-previous")
+	previous.Keys = []string{",", `"`, `\`}
+	want := make(map[string][]string)
+	for _, action := range Actions {
+		want[action.Name] = action.Keys
+	}
+
+	path := filepath.Join(t.TempDir(), "config")
+	if err := SaveConfig(path, &Monitor{}); err != nil {
+		t.Fatal(err)
+	}
+	// As on the next start.
+	for _, action := range Actions {
+		action.Keys = action.defaultKeys
+	}
+	if err := LoadConfig(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range Actions {
+		if !reflect.DeepEqual(action.Keys, want[action.Name]) {
+			t.Errorf("%s keys = %q, want %q", action.Name, action.Keys, want[action.Name])
+		}
+	}
+}
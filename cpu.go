@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CPUStat contains the time, in jiffies, that a CPU spent in each state
+// according to a cpu line of /proc/stat.
+type CPUStat struct {
+	// ID is the number of the CPU, or -1 for the aggregate of all CPUs.
+	ID int
+
+	User      uint64
+	Nice      uint64
+	System    uint64
+	Idle      uint64
+	IOWait    uint64
+	IRQ       uint64
+	SoftIRQ   uint64
+	Steal     uint64
+	Guest     uint64
+	GuestNice uint64
+}
+
+// parseCPULine parses a "cpu" or "cpuN" line of /proc/stat. Older kernels
+// have fewer columns, the missing ones are left zero.
+func parseCPULine(line string) (CPUStat, error) {
+	stat := CPUStat{ID: -1}
+
+	fields := strings.Fields(line)
+	if id := strings.TrimPrefix(fields[0], "cpu"); id != "" {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return stat, fmt.Errorf("malformed cpu id %q", fields[0])
+		}
+		stat.ID = n
+	}
+
+	values := []*uint64{
+		&stat.User, &stat.Nice, &stat.System, &stat.Idle, &stat.IOWait,
+		&stat.IRQ, &stat.SoftIRQ, &stat.Steal, &stat.Guest, &stat.GuestNice,
+	}
+	for i, field := range fields[1:] {
+		if i == len(values) {
+			break
+		}
+		value, err := ParseUint64(field)
+		if err != nil {
+			return stat, err
+		}
+		*values[i] = value
+	}
+	return stat, nil
+}
+
+// Total returns the sum of the time spent in all states.
+func (s CPUStat) Total() uint64 {
+	return s.User + s.Nice + s.System + s.Idle + s.IOWait + s.IRQ +
+		s.SoftIRQ + s.Steal + s.Guest + s.GuestNice
+}
+
+// Busy returns the time spent doing work, which excludes idle and iowait.
+func (s CPUStat) Busy() uint64 {
+	return s.Total() - s.Idle - s.IOWait
+}
+
+// Sub returns the time spent in each state since an earlier stat of the
+// same CPU. Counters that went backwards, e.g. because the CPU was taken
+// offline, count as zero.
+func (s CPUStat) Sub(earlier CPUStat) CPUStat {
+	return CPUStat{
+		ID:        s.ID,
+		User:      diff(s.User, earlier.User),
+		Nice:      diff(s.Nice, earlier.Nice),
+		System:    diff(s.System, earlier.System),
+		Idle:      diff(s.Idle, earlier.Idle),
+		IOWait:    diff(s.IOWait, earlier.IOWait),
+		IRQ:       diff(s.IRQ, earlier.IRQ),
+		SoftIRQ:   diff(s.SoftIRQ, earlier.SoftIRQ),
+		Steal:     diff(s.Steal, earlier.Steal),
+		Guest:     diff(s.Guest, earlier.Guest),
+		GuestNice: diff(s.GuestNice, earlier.GuestNice),
+	}
+}
+
+// Percent returns value as a percentage of the Total.
+func (s CPUStat) Percent(value uint64) float64 {
+	total := s.Total()
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(value) / float64(total)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// statusFields are the fields of /proc/<pid>/status shown in the detail
+// view.
+var statusFields = []string{
+	"VmPeak",
+	"VmSize",
+	"VmHWM",
+	"VmRSS",
+	"VmSwap",
+	"voluntary_ctxt_switches",
+	"nonvoluntary_ctxt_switches",
+}
+
+// detailView is a Dialog that shows everything known about a process,
+// read again after every update.
+type detailView struct {
+	textView
+	process *Process
+
+	// updated and width are the update time and screen width that the
+	// lines were built for.
+	updated time.Time
+	width   int
+}
+
+// HandleDetail opens the detail view for the selected process.
+func (ui *UI) HandleDetail() {
+	if p := ui.SelectedProcess(); p != nil {
+		ui.OpenDialog(&detailView{process: p})
+	}
+}
+
+func (v *detailView) Draw(ui *UI) {
+	if !v.updated.Equal(ui.monitor.Time) || v.width != ui.width {
+		v.refresh(ui.monitor, ui.width-8)
+		v.updated, v.width = ui.monitor.Time, ui.width
+	}
+	v.draw(ui)
+}
+
+func (v *detailView) HandleKey(ui *UI, ev termbox.Event) bool {
+	if v.handleScrollKey(ui, ev) {
+		return true
+	}
+	switch ev.Ch {
+	case 'o':
+		ui.OpenDialog(&filesView{detailSubview{back: v}})
+		return true
+	case 'm':
+		ui.OpenDialog(&mapsView{detailSubview: detailSubview{back: v}})
+		return true
+	}
+	return !(ev.Ch == 'q' || ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyEnter)
+}
+
+// refresh builds the lines, wrapping long values at width.
+func (v *detailView) refresh(m *Monitor, width int) {
+	// Replays load new Processes for every snapshot, so it's looked up
+	// again by Pid.
+	p, alive := m.Map[v.process.Pid]
+	if alive {
+		v.process = p
+	} else {
+		p = v.process
+	}
+	v.reset()
+	v.title = fmt.Sprintf("%v (o: open files, m: memory maps, q: close)", p)
+	if !alive {
+		v.title = fmt.Sprintf("%v has exited (q: close)", p)
+	}
+
+	v.section("Process")
+	v.wrap("Command", p.Command, width)
+	v.addf("%-12s %s", "User", p.User.Username)
+	v.addf("%-12s %c, %s", "State", p.State, stateDescription(p.State))
+	v.addf("%-12s %s", "Parents", parentChain(m, p))
+	v.addf("%-12s %d", "Threads", p.NumThreads)
+	v.addf("%-12s %d, nice %d", "Priority", p.Priority, p.Nice)
+	if m.Uptime > 0 {
+		// TODO: like TIME+ this assumes a CLK_TCK of 100.
+		age := m.Uptime - time.Duration(p.StartTime)*time.Second/100
+		started := m.Time.Add(-age).Format("2006-01-02 15:04:05")
+		v.addf("%-12s %s, %s ago", "Started", started, age.Truncate(time.Second))
+	}
+	v.addf("%-12s %s", "CPU time", CPUTimeColumn.Format(m, p))
+
+	if p.dir == "" {
+		// Replayed processes only have what was recorded.
+		return
+	}
+
+	exe, _ := os.Readlink(filepath.Join(p.dir, "exe"))
+	cwd, _ := os.Readlink(filepath.Join(p.dir, "cwd"))
+	v.wrap("Executable", orUnavailable(exe), width)
+	v.wrap("Directory", orUnavailable(cwd), width)
+
+	v.section("Status")
+	status := readStatusFields(filepath.Join(p.dir, "status"))
+	for _, field := range statusFields {
+		if value, ok := status[field]; ok {
+			v.addf("%-27s %s", field, value)
+		}
+	}
+
+	v.section("Limits")
+	v.addFile(filepath.Join(p.dir, "limits"))
+
+	v.section("Cgroups")
+	v.addFile(filepath.Join(p.dir, "cgroup"))
+
+	v.section("Namespaces")
+	names, _ := ioutil.ReadDir(filepath.Join(p.dir, "ns"))
+	if len(names) == 0 {
+		v.addf("unavailable")
+	}
+	for _, info := range names {
+		link, _ := os.Readlink(filepath.Join(p.dir, "ns", info.Name()))
+		v.addf("%-18s %s", info.Name(), orUnavailable(link))
+	}
+}
+
+// wrap adds a line with a label and value, continued on more lines if the
+// value is longer than width.
+func (v *detailView) wrap(label, value string, width int) {
+	const labelWidth = 13
+	// Arguments can contain newlines and tabs.
+	runes := []rune(strings.Map(func(r rune) rune {
+		if r < ' ' {
+			return ' '
+		}
+		return r
+	}, value))
+	n := width - labelWidth
+	if n < 10 {
+		n = 10
+	}
+	for first := true; first || len(runes) > 0; first = false {
+		end := n
+		if end > len(runes) {
+			end = len(runes)
+		}
+		v.addf("%-12s %s", label, string(runes[:end]))
+		runes, label = runes[end:], ""
+	}
+}
+
+// addFile adds the lines of a file, or a note if it can't be read.
+func (v *detailView) addFile(path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		v.addf("unavailable")
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		v.addf("%s", line)
+	}
+}
+
+// readStatusFields returns the values of the "Name:\tvalue" lines of a
+// status file, or nil if it can't be read.
+func readStatusFields(path string) map[string]string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			fields[parts[0]] = strings.TrimSpace(parts[1])
+		}
+	}
+	return fields
+}
+
+// parentChain returns the ancestors of p from init down to its parent,
+// like "1 (systemd) > 812 (sshd)".
+func parentChain(m *Monitor, p *Process) string {
+	var chain []string
+	seen := make(map[uint64]bool)
+	for ppid := p.Ppid; ppid != 0 && !seen[ppid]; {
+		seen[ppid] = true
+		parent, ok := m.Map[ppid]
+		if !ok {
+			chain = append(chain, fmt.Sprint(ppid))
+			break
+		}
+		chain = append(chain, parent.String())
+		ppid = parent.Ppid
+	}
+	if len(chain) == 0 {
+		return "none"
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return strings.Join(chain, " > ")
+}
+
+func stateDescription(state byte) string {
+	for _, s := range States {
+		if s.Letter == state {
+			return s.Description
+		}
+	}
+	return "unknown"
+}
+
+func orUnavailable(s string) string {
+	if s == "" {
+		return "unavailable"
+	}
+	return s
+}
+
+// detailSubview is the part shared by the views opened from a detailView,
+// which list more about its process. Their lines are rebuilt after every
+// update and closing them goes back to the detail view.
+type detailSubview struct {
+	textView
+	back *detailView
+
+	// updated is the Monitor's update time as of the last rebuild.
+	updated time.Time
+}
+
+// drawRefreshed draws the lines, rebuilt by refresh first if the Monitor
+// updated or they were reset.
+func (v *detailSubview) drawRefreshed(ui *UI, refresh func()) {
+	if !v.updated.Equal(ui.monitor.Time) || v.lines == nil {
+		refresh()
+		v.updated = ui.monitor.Time
+	}
+	v.draw(ui)
+}
+
+// handleBackKey scrolls for the movement keys and goes back to the detail
+// view for q, esc and enter. It returns whether ev was one of those.
+func (v *detailSubview) handleBackKey(ui *UI, ev termbox.Event) bool {
+	if v.handleScrollKey(ui, ev) {
+		return true
+	}
+	if ev.Ch == 'q' || ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyEnter {
+		ui.OpenDialog(v.back)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+const (
+	dialogFG = termbox.ColorDefault
+	dialogBG = termbox.ColorDefault
+)
+
+// A Dialog takes over the keyboard and draws over the process list until
+// it's closed.
+type Dialog interface {
+	Draw(ui *UI)
+
+	// HandleKey handles a key press and returns false once the Dialog
+	// should be closed.
+	HandleKey(ui *UI, ev termbox.Event) bool
+}
+
+// OpenDialog shows dialog until it's closed.
+func (ui *UI) OpenDialog(dialog Dialog) {
+	ui.dialog = dialog
+}
+
+// HandleDialogKey passes a key press to the open Dialog, if any. It returns
+// whether there was a Dialog to handle it. Ctrl-C is never handled by a
+// Dialog, so that it quits even while a prompt takes all other keys.
+func (ui *UI) HandleDialogKey(ev termbox.Event) bool {
+	if ui.dialog == nil || ev.Key == termbox.KeyCtrlC {
+		return false
+	}
+	if !ui.dialog.HandleKey(ui, ev) {
+		ui.dialog = nil
+	}
+	return true
+}
+
+// drawBox draws an empty box with a title in its top border and leaves
+// ui.x, ui.y at the first cell inside of it.
+func (ui *UI) drawBox(x, y, width, height int, title string) {
+	ui.fg, ui.bg = dialogFG, dialogBG
+	for row := 0; row < height; row++ {
+		ui.x, ui.y = x, y+row
+		for column := 0; column < width; column++ {
+			ch := ' '
+			switch {
+			case (row == 0 || row == height-1) && (column == 0 || column == width-1):
+				ch = '+'
+			case row == 0 || row == height-1:
+				ch = '-'
+			case column == 0 || column == width-1:
+				ch = '|'
+			}
+			ui.setCell(ch)
+		}
+	}
+
+	ui.x, ui.y = x+2, y
+	ui.fg = dialogFG | termbox.AttrBold
+	ui.writeString(" " + title + " ")
+	ui.fg = dialogFG
+
+	ui.x, ui.y = x+1, y+1
+}
+
+// writeBoxLine writes s on the current line of a box that's width wide,
+// padded or truncated to fit, and moves to the next line.
+func (ui *UI) writeBoxLine(x, width int, s string) {
+	ui.x = x + 1
+	inner := width - 2
+	s = runewidth.Truncate(s, inner, "")
+	ui.writeString(s)
+	for ui.x < x+1+inner {
+		ui.setCell(' ')
+	}
+	ui.y++
+}
+
+// editLine applies a key press to the text of a prompt. It returns false if
+// the key doesn't edit text.
+func editLine(text *string, ev termbox.Event) bool {
+	switch {
+	case ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2:
+		if *text != "" {
+			runes := []rune(*text)
+			*text = string(runes[:len(runes)-1])
+		}
+	case ev.Key == termbox.KeySpace:
+		*text += " "
+	case ev.Ch != 0:
+		*text += string(ev.Ch)
+	default:
+		return false
+	}
+	return true
+}
+
+// textView is a scrollable box of lines with section headings that fills
+// the space of the process list.
+type textView struct {
+	title    string
+	lines    []string
+	headings map[int]bool
+	scroll   int
+}
+
+// reset removes all lines.
+func (v *textView) reset() {
+	v.lines = nil
+	v.headings = make(map[int]bool)
+}
+
+// section starts a section with a heading.
+func (v *textView) section(heading string) {
+	if v.headings == nil {
+		v.headings = make(map[int]bool)
+	}
+	if len(v.lines) > 0 {
+		v.lines = append(v.lines, "")
+	}
+	v.headings[len(v.lines)] = true
+	v.lines = append(v.lines, heading)
+}
+
+// addf adds a line formatted with fmt.Sprintf.
+func (v *textView) addf(format string, a ...interface{}) {
+	v.lines = append(v.lines, fmt.Sprintf(format, a...))
+}
+
+func (v *textView) draw(ui *UI) {
+	width := ui.width - 4
+	height := ui.height - ui.headerRows() - footerRows
+	x, y := 2, ui.headerRows()
+	rows := height - 2
+
+	if v.scroll > len(v.lines)-rows {
+		v.scroll = len(v.lines) - rows
+	}
+	if v.scroll < 0 {
+		v.scroll = 0
+	}
+
+	ui.unscrolled(func() {
+		ui.drawBox(x, y, width, height, v.title)
+		for i := v.scroll; i < len(v.lines) && i < v.scroll+rows; i++ {
+			if v.headings[i] {
+				ui.fg = dialogFG | termbox.AttrBold
+			}
+			ui.writeBoxLine(x, width, v.lines[i])
+			ui.fg = dialogFG
+		}
+	})
+}
+
+// handleScrollKey scrolls for the movement keys and returns whether ev
+// was one of them.
+func (v *textView) handleScrollKey(ui *UI, ev termbox.Event) bool {
+	switch {
+	case ev.Ch == 'j' || ev.Key == termbox.KeyArrowDown:
+		v.scroll++
+	case ev.Ch == 'k' || ev.Key == termbox.KeyArrowUp:
+		v.scroll--
+	case ev.Key == termbox.KeyPgdn || ev.Key == termbox.KeyCtrlD:
+		v.scroll += ui.numProcessesOnScreen() / 2
+	case ev.Key == termbox.KeyPgup || ev.Key == termbox.KeyCtrlU:
+		v.scroll -= ui.numProcessesOnScreen() / 2
+	case ev.Ch == 'g' || ev.Key == termbox.KeyHome:
+		v.scroll = 0
+	case ev.Ch == 'G' || ev.Key == termbox.KeyEnd:
+		// draw stops at the last line.
+		v.scroll = len(v.lines)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Exporter serves the data of a Monitor as Prometheus metrics in the text
+// exposition format.
+type Exporter struct {
+	mu      sync.Mutex
+	monitor *Monitor
+}
+
+// NewExporter returns an Exporter for monitor.
+func NewExporter(monitor *Monitor) *Exporter {
+	return &Exporter{monitor: monitor}
+}
+
+// ListenAndServe serves /metrics on addr.
+func (e *Exporter) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	return http.ListenAndServe(addr, mux)
+}
+
+// ServeHTTP updates the Monitor and writes its metrics. Updating on every
+// scrape keeps the counters as fresh as the scraper asks for.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Only an abandoned update leaves nothing to export.
+	if err := e.monitor.Update(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	e.write(bw)
+	bw.Flush()
+}
+
+func (e *Exporter) write(w io.Writer) {
+	m := e.monitor
+
+	writeFamily(w, "jtop_cpu_jiffies_total", "counter",
+		"Total CPU time of all CPUs in jiffies.")
+	fmt.Fprintf(w, "jtop_cpu_jiffies_total %d\n", m.CPUTimeTotal)
+
+	writeFamily(w, "jtop_memory_total_bytes", "gauge",
+		"Total usable memory in bytes.")
+	fmt.Fprintf(w, "jtop_memory_total_bytes %d\n", m.MemTotal)
+
+	writeFamily(w, "jtop_sampling_errors_total", "counter",
+		"Number of errors encountered while reading the proc filesystem.")
+	fmt.Fprintf(w, "jtop_sampling_errors_total %d\n", m.Errors)
+
+	writeFamily(w, "jtop_process_cpu_jiffies_total", "counter",
+		"CPU time of a process in jiffies, by mode.")
+	for _, p := range m.Ordered() {
+		labels := processLabels(p)
+		fmt.Fprintf(w, "jtop_process_cpu_jiffies_total{%s,mode=\"user\"} %d\n", labels, p.Utime)
+		fmt.Fprintf(w, "jtop_process_cpu_jiffies_total{%s,mode=\"system\"} %d\n", labels, p.Stime)
+	}
+
+	writeFamily(w, "jtop_process_resident_memory_bytes", "gauge",
+		"Resident set size of a process in bytes.")
+	for _, p := range m.Ordered() {
+		fmt.Fprintf(w, "jtop_process_resident_memory_bytes{%s} %d\n",
+			processLabels(p), p.RSS*m.PageSize)
+	}
+
+	writeFamily(w, "jtop_process_state", "gauge",
+		"State of a process, the sample with the current state is 1.")
+	for _, p := range m.Ordered() {
+		fmt.Fprintf(w, "jtop_process_state{%s,state=\"%c\"} 1\n",
+			processLabels(p), p.State)
+	}
+}
+
+func writeFamily(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+func processLabels(p *Process) string {
+	return fmt.Sprintf("pid=\"%d\",user=\"%s\",name=\"%s\"",
+		p.Pid, labelEscaper.Replace(p.User.Username), labelEscaper.Replace(p.Name))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/nsf/termbox-go"
+)
+
+// openFlags are the flags of fdinfo shown besides the access mode. O_SYNC
+// includes the bit of O_DSYNC, so it comes first and the bits of a flag
+// that matched aren't matched again.
+var openFlags = []struct {
+	Flag uint64
+	Name string
+}{
+	{syscall.O_APPEND, "append"},
+	{syscall.O_NONBLOCK, "nonblock"},
+	{syscall.O_SYNC, "sync"},
+	{syscall.O_DSYNC, "dsync"},
+	{syscall.O_DIRECT, "direct"},
+	{syscall.O_DIRECTORY, "directory"},
+	{syscall.O_NOATIME, "noatime"},
+	{syscall.O_CLOEXEC, "cloexec"},
+}
+
+// A fileDescriptor is an open file of a process.
+type fileDescriptor struct {
+	FD     uint64
+	Target string // what /proc/<pid>/fd/<fd> links to
+	Flags  string
+	Pos    uint64
+}
+
+// readFileDescriptors returns the open files of the process whose proc
+// directory is dir, ordered by number.
+func readFileDescriptors(dir string) ([]fileDescriptor, error) {
+	names, err := readDirNames(filepath.Join(dir, "fd"))
+	if err != nil {
+		return nil, err
+	}
+
+	var fds []fileDescriptor
+	for _, name := range names {
+		fd, err := ParseUint64(name)
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(dir, "fd", name))
+		if err != nil {
+			continue // closed since the directory was read
+		}
+		fds = append(fds, fileDescriptor{FD: fd, Target: target})
+		parseFDInfoFile(filepath.Join(dir, "fdinfo", name), &fds[len(fds)-1])
+	}
+	sort.Slice(fds, func(i, j int) bool { return fds[i].FD < fds[j].FD })
+	return fds, nil
+}
+
+// parseFDInfoFile sets the position and flags of fd from its fdinfo file.
+func parseFDInfoFile(path string, fd *fileDescriptor) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	// data = "pos:\t0\nflags:\t02100002\nmnt_id:\t25\n..."
+	for _, line := range strings.Split(string(data), "\n") {
+		values := strings.Fields(line)
+		if len(values) != 2 {
+			continue
+		}
+		switch values[0] {
+		case "pos:":
+			fd.Pos, _ = ParseUint64(values[1])
+		case "flags:":
+			if flags, err := strconv.ParseUint(values[1], 8, 64); err == nil {
+				fd.Flags = formatOpenFlags(flags)
+			}
+		}
+	}
+}
+
+// formatOpenFlags formats the flags of open(2) like "rw,append".
+func formatOpenFlags(flags uint64) string {
+	names := []string{"r"}
+	switch flags & syscall.O_ACCMODE {
+	case syscall.O_WRONLY:
+		names[0] = "w"
+	case syscall.O_RDWR:
+		names[0] = "rw"
+	}
+	for _, flag := range openFlags {
+		if flags&flag.Flag == flag.Flag {
+			names = append(names, flag.Name)
+			flags &^= flag.Flag
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// readDirNames returns the names in a directory without the cost of a
+// stat for each of them.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+// filesView lists the open files of the detail view's process, with
+// sockets resolved to their addresses.
+type filesView struct {
+	detailSubview
+}
+
+func (v *filesView) Draw(ui *UI) {
+	v.drawRefreshed(ui, v.refresh)
+}
+
+func (v *filesView) HandleKey(ui *UI, ev termbox.Event) bool {
+	v.handleBackKey(ui, ev)
+	return true
+}
+
+func (v *filesView) refresh() {
+	p := v.back.process
+	v.reset()
+	v.title = fmt.Sprintf("Open files of %v (q to go back)", p)
+
+	if p.dir == "" {
+		v.addf("Open files aren't recorded.")
+		return
+	}
+	fds, err := readFileDescriptors(p.dir)
+	if err != nil {
+		v.addf("%v", err)
+		return
+	}
+
+	sockets := readSockets(filepath.Join(p.dir, "net"))
+	width := len("MODE")
+	for _, fd := range fds {
+		if len(fd.Flags) > width {
+			width = len(fd.Flags)
+		}
+	}
+	v.addf("%5s  %-*s %10s  %s", "FD", width, "MODE", "POS", "NAME")
+	for _, fd := range fds {
+		name := fd.Target
+		var inode uint64
+		if _, err := fmt.Sscanf(fd.Target, "socket:[%d]", &inode); err == nil {
+			if socket, ok := sockets[inode]; ok {
+				name = socket.String()
+			}
+		}
+		v.addf("%5d  %-*s %10d  %s", fd.FD, width, fd.Flags, fd.Pos, name)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestFormatOpenFlags(t *testing.T) {
+	tests := []struct {
+		flags uint64
+		want  string
+	}{
+		{syscall.O_RDONLY, "r"},
+		{syscall.O_WRONLY | syscall.O_APPEND, "w,append"},
+		{syscall.O_RDWR | syscall.O_SYNC, "rw,sync"},
+		{syscall.O_RDWR | syscall.O_DSYNC, "rw,dsync"},
+		{syscall.O_RDONLY | syscall.O_NONBLOCK | syscall.O_CLOEXEC, "r,nonblock,cloexec"},
+	}
+	for _, test := range tests {
+		if got := formatOpenFlags(test.flags); got != test.want {
+			t.Errorf("formatOpenFlags(%#o) = %q, want %q", test.flags, got, test.want)
+		}
+	}
+}
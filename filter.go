@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Filter is a predicate on processes parsed from an expression like
+//
+//	user==postgres && cpu>5 && state!=S && cmd~"worker"
+//
+// Comparisons of a field with a value can be combined with &&, || and !,
+// and grouped with parentheses. Text fields support ==, != and the regular
+// expression matches ~ and !~, numeric fields ==, !=, <, <=, > and >=.
+// Sizes in bytes may have a K, M or G suffix.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// ProcessFilter is the Filter given with the --filter option.
+var ProcessFilter *Filter
+
+// filterField is a Process field that can be used in a Filter. Exactly one
+// of text and number is set.
+type filterField struct {
+	text   func(m *Monitor, p *Process) string
+	number func(m *Monitor, p *Process) float64
+}
+
+// FilterFields are the fields that can be used in a Filter.
+var FilterFields = map[string]filterField{
+	"pid":    {number: func(m *Monitor, p *Process) float64 { return float64(p.Pid) }},
+	"ppid":   {number: func(m *Monitor, p *Process) float64 { return float64(p.Ppid) }},
+	"user":   {text: func(m *Monitor, p *Process) string { return p.User.Username }},
+	"uid":    {text: func(m *Monitor, p *Process) string { return p.User.Uid }},
+	"name":   {text: func(m *Monitor, p *Process) string { return p.Name }},
+	"cmd":    {text: func(m *Monitor, p *Process) string { return p.Command }},
+	"state":  {text: func(m *Monitor, p *Process) string { return string(p.State) }},
+	"cpu":    {number: func(m *Monitor, p *Process) float64 { return m.CPUPercent(p) }},
+	"mem":    {number: func(m *Monitor, p *Process) float64 { return m.MemPercent(p) }},
+	"rss":    {number: func(m *Monitor, p *Process) float64 { return float64(p.RSS * m.PageSize) }},
+	"pss":    {number: func(m *Monitor, p *Process) float64 { return float64(p.PSS) }},
+	"uss":    {number: func(m *Monitor, p *Process) float64 { return float64(p.USS) }},
+	"swap":   {number: func(m *Monitor, p *Process) float64 { return float64(p.Swap) }},
+	"time":   {number: func(m *Monitor, p *Process) float64 { return float64(p.Utime+p.Stime) / 100 }},
+	"nice":   {number: func(m *Monitor, p *Process) float64 { return float64(p.Nice) }},
+	"pri":    {number: func(m *Monitor, p *Process) float64 { return float64(p.Priority) }},
+	"io_r":   {number: func(m *Monitor, p *Process) float64 { return m.Rate(p.ReadBytesDiff) }},
+	"io_w":   {number: func(m *Monitor, p *Process) float64 { return m.Rate(p.WriteBytesDiff) }},
+	"fds":    {number: func(m *Monitor, p *Process) float64 { return float64(p.FDs) }},
+	"estab":  {number: func(m *Monitor, p *Process) float64 { return float64(p.Established) }},
+	"listen": {number: func(m *Monitor, p *Process) float64 { return float64(p.Listening) }},
+	"net_rx": {number: func(m *Monitor, p *Process) float64 { return m.Rate(p.NetRxBytesDiff) }},
+	"net_tx": {number: func(m *Monitor, p *Process) float64 { return m.Rate(p.NetTxBytesDiff) }},
+}
+
+// ParseFilter parses a filter expression.
+func ParseFilter(expr string) (*Filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	parser := &filterParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token != "" {
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// Match returns whether p, as seen by m, matches the Filter.
+func (f *Filter) Match(m *Monitor, p *Process) bool {
+	return f.root.match(m, p)
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+type filterNode interface {
+	match(m *Monitor, p *Process) bool
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) match(m *Monitor, p *Process) bool {
+	return n.left.match(m, p) && n.right.match(m, p)
+}
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) match(m *Monitor, p *Process) bool {
+	return n.left.match(m, p) || n.right.match(m, p)
+}
+
+type notNode struct{ node filterNode }
+
+func (n notNode) match(m *Monitor, p *Process) bool {
+	return !n.node.match(m, p)
+}
+
+type textNode struct {
+	field filterField
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (n textNode) match(m *Monitor, p *Process) bool {
+	text := n.field.text(m, p)
+	switch n.op {
+	case "==":
+		return text == n.value
+	case "!=":
+		return text != n.value
+	case "~":
+		return n.re.MatchString(text)
+	default: // "!~"
+		return !n.re.MatchString(text)
+	}
+}
+
+type numberNode struct {
+	field filterField
+	op    string
+	value float64
+}
+
+func (n numberNode) match(m *Monitor, p *Process) bool {
+	number := n.field.number(m, p)
+	switch n.op {
+	case "==":
+		return number == n.value
+	case "!=":
+		return number != n.value
+	case "<":
+		return number < n.value
+	case "<=":
+		return number <= n.value
+	case ">":
+		return number > n.value
+	default: // ">="
+		return number >= n.value
+	}
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (fp *filterParser) peek() string {
+	if fp.pos == len(fp.tokens) {
+		return ""
+	}
+	return fp.tokens[fp.pos]
+}
+
+func (fp *filterParser) next() string {
+	token := fp.peek()
+	if token != "" {
+		fp.pos++
+	}
+	return token
+}
+
+// or := and ("||" and)*
+func (fp *filterParser) parseOr() (filterNode, error) {
+	left, err := fp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for fp.peek() == "||" {
+		fp.next()
+		right, err := fp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+// and := unary ("&&" unary)*
+func (fp *filterParser) parseAnd() (filterNode, error) {
+	left, err := fp.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for fp.peek() == "&&" {
+		fp.next()
+		right, err := fp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+// unary := "!" unary | "(" or ")" | comparison
+func (fp *filterParser) parseUnary() (filterNode, error) {
+	switch fp.peek() {
+	case "!":
+		fp.next()
+		node, err := fp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	case "(":
+		fp.next()
+		node, err := fp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if fp.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return node, nil
+	}
+	return fp.parseComparison()
+}
+
+// comparison := field op value
+func (fp *filterParser) parseComparison() (filterNode, error) {
+	name := fp.next()
+	if name == "" {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+	field, ok := FilterFields[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", name)
+	}
+
+	op := fp.next()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "~", "!~":
+	default:
+		return nil, fmt.Errorf("expected a comparison after %s", name)
+	}
+	value := fp.next()
+	if value == "" {
+		return nil, fmt.Errorf("expected a value after %s%s", name, op)
+	}
+	value = unquoteFilterValue(value)
+
+	if field.text != nil {
+		node := textNode{field: field, op: op, value: value}
+		switch op {
+		case "==", "!=":
+		case "~", "!~":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, err
+			}
+			node.re = re
+		default:
+			return nil, fmt.Errorf("%s can't be compared with %q", name, op)
+		}
+		return node, nil
+	}
+
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("%s can't be compared with %q", name, op)
+	}
+	number, err := parseFilterNumber(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s needs a number, not %q", name, value)
+	}
+	return numberNode{field: field, op: op, value: number}, nil
+}
+
+// unquoteFilterValue removes the quotes around a value, if any. Only \" and
+// \\ are escapes, so that the backslashes of a regular expression like
+// "worker \d+" are kept.
+func unquoteFilterValue(s string) string {
+	if len(s) < 2 || s[0] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parseFilterNumber parses a number with an optional K, M or G suffix.
+func parseFilterNumber(s string) (float64, error) {
+	multiplier := 1.0
+	if s != "" {
+		switch unicode.ToUpper(rune(s[len(s)-1])) {
+		case 'K':
+			multiplier = KB
+		case 'M':
+			multiplier = MB
+		case 'G':
+			multiplier = GB
+		}
+		if multiplier != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	number, err := strconv.ParseFloat(s, 64)
+	return number * multiplier, err
+}
+
+// tokenizeFilter splits an expression into operators, parentheses, quoted
+// strings and words.
+func tokenizeFilter(expr string) ([]string, error) {
+	operators := []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "<", ">", "~", "!", "(", ")"}
+
+	var tokens []string
+	for i := 0; i < len(expr); {
+		if expr[i] == ' ' || expr[i] == '\t' {
+			i++
+			continue
+		}
+
+		if expr[i] == '"' {
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, expr[i:end+1])
+			i = end + 1
+			continue
+		}
+
+		operator := ""
+		for _, op := range operators {
+			if strings.HasPrefix(expr[i:], op) {
+				operator = op
+				break
+			}
+		}
+		if operator != "" {
+			tokens = append(tokens, operator)
+			i += len(operator)
+			continue
+		}
+
+		end := i
+		for end < len(expr) && !strings.ContainsRune(" \t\"&|=!<>~()", rune(expr[end])) {
+			end++
+		}
+		if end == i {
+			return nil, fmt.Errorf("unexpected %q", expr[i])
+		}
+		tokens = append(tokens, expr[i:end])
+		i = end
+	}
+	return tokens, nil
+}
+
+// filterPrompt is a Dialog on the status bar to edit the Filter of the
+// Monitor.
+type filterPrompt struct {
+	expr string
+	err  error
+}
+
+// HandleFilter opens the filter prompt with the current filter.
+func (ui *UI) HandleFilter() {
+	prompt := &filterPrompt{}
+	if ui.monitor.Filter != nil {
+		prompt.expr = ui.monitor.Filter.String()
+	}
+	ui.OpenDialog(prompt)
+}
+
+func (fp *filterPrompt) Draw(ui *UI) {
+	ui.y, ui.x = ui.height-footerRows, 0
+	ui.fg, ui.bg = termbox.ColorDefault, termbox.ColorDefault
+
+	ui.unscrolled(func() {
+		ui.writeString("filter: " + fp.expr)
+		termbox.SetCursor(ui.x, ui.y)
+		ui.writeString("   ")
+		if fp.err != nil {
+			ui.fg, ui.bg = statusFG, statusBG
+			ui.writeLastColumn(fp.err.Error())
+			return
+		}
+		ui.writeLastColumn("enter: apply  esc: cancel  e.g. user==root && cpu>5")
+	})
+}
+
+func (fp *filterPrompt) HandleKey(ui *UI, ev termbox.Event) bool {
+	switch {
+	case ev.Key == termbox.KeyEsc:
+		termbox.HideCursor()
+		return false
+	case ev.Key == termbox.KeyEnter:
+		var filter *Filter
+		if strings.TrimSpace(fp.expr) != "" {
+			if filter, fp.err = ParseFilter(fp.expr); fp.err != nil {
+				return true
+			}
+		}
+		termbox.HideCursor()
+		selected := ui.SelectedProcess()
+		ui.monitor.Filter = filter
+		ui.monitor.Arrange()
+		ui.selectProcess(selected)
+		return false
+	case editLine(&fp.expr, ev):
+		fp.err = nil
+	}
+	return true
+}
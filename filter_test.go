@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestFilterQuotedValues(t *testing.T) {
+	tests := []struct {
+		expr    string
+		command string
+		match   bool
+	}{
+		{`cmd~"worker \d+"`, "worker 12", true},
+		{`cmd~"worker \d+"`, "worker x", false},
+		{`cmd~"^/usr/\\w+"`, "/usr/bin", true},
+		{`cmd=="say \"hi\""`, `say "hi"`, true},
+		{`cmd=="a\\b"`, `a\b`, true},
+		{`cmd~worker`, "a worker", true},
+	}
+	for _, test := range tests {
+		filter, err := ParseFilter(test.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", test.expr, err)
+			continue
+		}
+		p := &Process{Command: test.command}
+		if match := filter.Match(&Monitor{}, p); match != test.match {
+			t.Errorf("%q matching %q = %v, want %v", test.expr, test.command,
+				match, test.match)
+		}
+	}
+}
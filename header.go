@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+const (
+	meterMinWidth  = 40
+	meterMaxColumn = 4
+
+	// CPU meters are packed down to this width when there are too many
+	// for the rows they may take.
+	meterCompactWidth = 16
+
+	// Pressure averages, in percent, from which they're highlighted.
+	pressureWarning  = 10
+	pressureCritical = 40
+)
+
+// meterSegment is a part of a meter, fraction is between 0 and 1.
+type meterSegment struct {
+	fraction float64
+	fg       termbox.Attribute
+}
+
+// summaryRows returns the number of rows used by the summary above the
+// process list.
+func (ui *UI) summaryRows() int {
+	rows := 3 // load and tasks, CPU breakdown, memory details
+	if ui.monitor.Mem.MemTotal > 0 {
+		rows++ // memory and swap meters
+	}
+	if ui.monitor.PSI.Available() {
+		rows++
+	}
+	if ui.monitor.CgroupPSI.Available() {
+		rows++
+	}
+	_, cpuRows := ui.cpuMeterLayout()
+	return rows + cpuRows
+}
+
+// drawSummary draws the system wide information above the process list.
+// It doesn't scroll horizontally with the process list.
+func (ui *UI) drawSummary() {
+	ui.unscrolled(func() {
+		ui.drawLoad()
+		ui.drawCPUBreakdown()
+		ui.drawCPUMeters()
+		ui.drawMemMeters()
+		ui.drawMemDetails()
+		ui.drawPSI("PSI ", ui.monitor.PSI)
+		ui.drawPSI("PSI cgroup ", ui.monitor.CgroupPSI)
+	})
+}
+
+// drawLoad draws the load average, uptime and the number of processes in
+// each state.
+func (ui *UI) drawLoad() {
+	ui.x = 0
+	ui.fg, ui.bg = termbox.ColorDefault, termbox.ColorDefault
+
+	m := ui.monitor
+	ui.writeLabel("Load ")
+	ui.writeValue("", fmt.Sprintf("%.2f %.2f %.2f", m.LoadAvg[0], m.LoadAvg[1], m.LoadAvg[2]))
+	ui.writeLabel("Uptime ")
+	ui.writeValue("", formatUptime(m.Uptime))
+
+	counts := m.StateCounts()
+	ui.writeLabel("Tasks ")
+	ui.writeValue("", strconv.Itoa(len(m.List)))
+	for _, state := range []byte("RSDZT") {
+		ui.writeValue(string(state), strconv.Itoa(counts[state]))
+	}
+	ui.writeLastColumn("")
+
+	ui.y++
+}
+
+// drawCPUBreakdown draws the percentage of time all CPUs spent in each
+// state since the last update.
+func (ui *UI) drawCPUBreakdown() {
+	ui.x = 0
+	ui.fg, ui.bg = termbox.ColorDefault, termbox.ColorDefault
+
+	diff := ui.monitor.CPUDiff
+	ui.writeLabel("CPU ")
+	ui.writeStat("us", diff.Percent(diff.User), termbox.ColorGreen)
+	ui.writeStat("ni", diff.Percent(diff.Nice), termbox.ColorBlue)
+	ui.writeStat("sy", diff.Percent(diff.System), termbox.ColorRed)
+	ui.writeStat("hi", diff.Percent(diff.IRQ), termbox.ColorMagenta)
+	ui.writeStat("si", diff.Percent(diff.SoftIRQ), termbox.ColorMagenta)
+	ui.writeStat("wa", diff.Percent(diff.IOWait), termbox.ColorYellow)
+	ui.writeStat("st", diff.Percent(diff.Steal), termbox.ColorCyan)
+	ui.writeStat("id", diff.Percent(diff.Idle), termbox.ColorDefault)
+	ui.writeLastColumn("")
+
+	ui.y++
+}
+
+// drawCPUMeters draws a meter for every CPU, in as many columns as fit.
+func (ui *UI) drawCPUMeters() {
+	columns, rows := ui.cpuMeterLayout()
+	if rows == 0 {
+		return
+	}
+	width := ui.width / columns
+
+	top := ui.y
+	for i, diff := range ui.monitor.CPUsDiff {
+		// Number the CPUs down each column, like htop.
+		row, column := i%rows, i/rows
+		ui.y, ui.x = top+row, column*width
+		label := fmt.Sprintf("%3d", diff.ID)
+		ui.drawMeter(label, width-1, []meterSegment{
+			{diff.Percent(diff.Nice) / 100, termbox.ColorBlue},
+			{diff.Percent(diff.User) / 100, termbox.ColorGreen},
+			{diff.Percent(diff.System) / 100, termbox.ColorRed},
+			{diff.Percent(diff.IRQ+diff.SoftIRQ) / 100, termbox.ColorMagenta},
+			{diff.Percent(diff.IOWait) / 100, termbox.ColorYellow},
+			{diff.Percent(diff.Steal) / 100, termbox.ColorCyan},
+		}, fmt.Sprintf("%.1f%%", diff.Percent(diff.Busy())))
+	}
+
+	ui.y = top + rows
+}
+
+// drawMemMeters draws a memory and a swap meter side by side.
+func (ui *UI) drawMemMeters() {
+	mem := ui.monitor.Mem
+	if mem.MemTotal == 0 {
+		// Recordings from before memory was sampled.
+		return
+	}
+	width := ui.width / 2
+
+	// Used is everything that isn't free, buffers or cache. The text shows
+	// what can't be made available, which is what matters for pressure.
+	total := float64(mem.MemTotal)
+	used := mem.MemTotal - mem.MemFree - mem.Buffers - mem.Cached
+	if mem.MemFree+mem.Buffers+mem.Cached > mem.MemTotal {
+		used = 0
+	}
+	ui.x = 0
+	ui.drawMeter("Mem", width-1, []meterSegment{
+		{float64(used) / total, termbox.ColorGreen},
+		{float64(mem.Buffers) / total, termbox.ColorBlue},
+		{float64(mem.Cached) / total, termbox.ColorYellow},
+	}, formatBytes(mem.MemUsed())+"/"+formatBytes(mem.MemTotal))
+
+	var swapUsed float64
+	if mem.SwapTotal > 0 {
+		swapUsed = float64(mem.SwapUsed()) / float64(mem.SwapTotal)
+	}
+	ui.x = width
+	ui.drawMeter("Swp", width-1, []meterSegment{
+		{swapUsed, termbox.ColorRed},
+	}, formatBytes(mem.SwapUsed())+"/"+formatBytes(mem.SwapTotal))
+
+	ui.y++
+}
+
+// drawMemDetails draws the memory counters that don't fit in the meters.
+func (ui *UI) drawMemDetails() {
+	ui.x = 0
+	ui.fg, ui.bg = termbox.ColorDefault, termbox.ColorDefault
+
+	mem := ui.monitor.Mem
+	ui.writeString("    ")
+	ui.writeValue("avail", formatBytes(mem.MemAvailable))
+	ui.writeValue("buff", formatBytes(mem.Buffers))
+	ui.writeValue("cache", formatBytes(mem.Cached))
+	ui.writeValue("shmem", formatBytes(mem.Shmem))
+	ui.writeValue("dirty", formatBytes(mem.Dirty))
+	ui.writeValue("writeback", formatBytes(mem.Writeback))
+	if mem.HugePagesTotal > 0 {
+		ui.writeValue("huge", fmt.Sprintf("%d/%d x %s",
+			mem.HugePagesTotal-mem.HugePagesFree, mem.HugePagesTotal,
+			formatBytes(mem.HugePageSize)))
+	}
+	ui.writeLastColumn("")
+
+	ui.y++
+}
+
+// drawPSI draws the pressure of each resource as "some" and "full"
+// averages over 10, 60 and 300 seconds. Nothing is drawn if the kernel
+// doesn't support PSI.
+func (ui *UI) drawPSI(label string, psi PSI) {
+	if !psi.Available() {
+		return
+	}
+	ui.x = 0
+	ui.fg, ui.bg = termbox.ColorDefault, termbox.ColorDefault
+
+	ui.writeLabel(label)
+	resources := []struct {
+		name     string
+		pressure *Pressure
+	}{
+		{"cpu", psi.CPU},
+		{"mem", psi.Memory},
+		{"io", psi.IO},
+	}
+	for _, resource := range resources {
+		if resource.pressure == nil {
+			continue
+		}
+		ui.writeString(resource.name)
+		ui.writePressure("some", resource.pressure.Some)
+		if resource.pressure.HasFull {
+			ui.writePressure("full", resource.pressure.Full)
+		}
+		ui.writeString("  ")
+	}
+	ui.writeLastColumn("")
+
+	ui.y++
+}
+
+// writePressure writes a PressureStat like " some 1.2 0.8 0.3", coloring
+// each average by how severe it is.
+func (ui *UI) writePressure(name string, stat PressureStat) {
+	ui.writeString(" " + name)
+	previous := ui.fg
+	for _, avg := range []float64{stat.Avg10, stat.Avg60, stat.Avg300} {
+		ui.fg = termbox.ColorGreen
+		if avg >= pressureCritical {
+			ui.fg = termbox.ColorRed | termbox.AttrBold
+		} else if avg >= pressureWarning {
+			ui.fg = termbox.ColorYellow
+		}
+		ui.writeString(fmt.Sprintf(" %.1f", avg))
+	}
+	ui.fg = previous
+}
+
+// drawMeter draws a bar meter like "label[|||||     text]" that is width
+// cells wide. The text is drawn over the end of the bar.
+func (ui *UI) drawMeter(label string, width int, segments []meterSegment, text string) {
+	ui.fg, ui.bg = termbox.ColorCyan, termbox.ColorDefault
+	ui.writeString(label)
+	ui.fg = termbox.ColorDefault
+	ui.setCell('[')
+
+	inner := width - runewidth.StringWidth(label) - 2
+	if inner < 0 {
+		inner = 0
+	}
+	cells := make([]termbox.Attribute, 0, inner)
+	for _, segment := range segments {
+		count := int(math.Round(segment.fraction * float64(inner)))
+		for i := 0; i < count && len(cells) < inner; i++ {
+			cells = append(cells, segment.fg)
+		}
+	}
+
+	textStart := inner - runewidth.StringWidth(text)
+	for i := 0; i < inner; i++ {
+		ch, fg := ' ', termbox.ColorDefault
+		if i < len(cells) {
+			ch, fg = '|', cells[i]
+		}
+		if i >= textStart {
+			ch, fg = []rune(text)[i-textStart], termbox.ColorDefault|termbox.AttrBold
+		}
+		ui.fg = fg
+		ui.setCell(ch)
+	}
+
+	ui.fg = termbox.ColorDefault
+	ui.setCell(']')
+}
+
+// meterColumns returns how many meters are drawn side by side.
+func (ui *UI) meterColumns() int {
+	columns := ui.width / meterMinWidth
+	if columns > meterMaxColumn {
+		columns = meterMaxColumn
+	}
+	if n := len(ui.monitor.CPUs); columns > n {
+		columns = n
+	}
+	if columns < 1 {
+		columns = 1
+	}
+	return columns
+}
+
+// cpuMeterLayout returns the columns and rows of the CPU meters. They take
+// at most a third of the screen, packed into narrower columns on hosts with
+// many CPUs, and aren't drawn if they don't fit even then: the CPU
+// breakdown above them still sums up all CPUs.
+func (ui *UI) cpuMeterLayout() (columns, rows int) {
+	n := len(ui.monitor.CPUs)
+	if n == 0 {
+		return 0, 0
+	}
+	maxRows := ui.height / 3
+	if maxRows < 1 {
+		maxRows = 1
+	}
+
+	columns = ui.meterColumns()
+	if rows = (n + columns - 1) / columns; rows <= maxRows {
+		return columns, rows
+	}
+	columns = (n + maxRows - 1) / maxRows
+	if ui.width/columns < meterCompactWidth {
+		return 0, 0
+	}
+	return columns, (n + columns - 1) / columns
+}
+
+// writeLabel writes a bold label.
+func (ui *UI) writeLabel(label string) {
+	fg := ui.fg
+	ui.fg = termbox.ColorDefault | termbox.AttrBold
+	ui.writeString(label)
+	ui.fg = fg
+}
+
+// writeStat writes a percentage like "us 12.3 " with the value in fg.
+func (ui *UI) writeStat(name string, percent float64, fg termbox.Attribute) {
+	ui.writeString(name + " ")
+	previous := ui.fg
+	ui.fg = fg
+	ui.writeString(fmt.Sprintf("%5.1f", percent))
+	ui.fg = previous
+	ui.writeString("  ")
+}
+
+// writeValue writes a value like "avail 1.2G " with the value in bold. The
+// name may be empty.
+func (ui *UI) writeValue(name, value string) {
+	if name != "" {
+		ui.writeString(name + " ")
+	}
+	previous := ui.fg
+	ui.fg = termbox.ColorDefault | termbox.AttrBold
+	ui.writeString(value)
+	ui.fg = previous
+	ui.writeString("  ")
+}
+
+// formatUptime formats a duration like "3 days, 04:12:05".
+func formatUptime(uptime time.Duration) string {
+	seconds := int64(uptime / time.Second)
+	days := seconds / (24 * 60 * 60)
+	clock := fmt.Sprintf("%02d:%02d:%02d", seconds/3600%24, seconds/60%60, seconds%60)
+	switch days {
+	case 0:
+		return clock
+	case 1:
+		return "1 day, " + clock
+	default:
+		return fmt.Sprintf("%d days, %s", days, clock)
+	}
+}
+
+func (ui *UI) writeString(s string) {
+	for _, ch := range s {
+		ui.setCell(ch)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// States are the letters of the S column, see proc(5).
+var States = []struct {
+	Letter      byte
+	Description string
+}{
+	{'R', "running or runnable"},
+	{'S', "sleeping in an interruptible wait"},
+	{'D', "waiting in uninterruptible disk sleep"},
+	{'Z', "zombie, exited but not yet reaped by its parent"},
+	{'T', "stopped by a signal"},
+	{'t', "stopped by a debugger"},
+	{'W', "paging (before Linux 2.6.0) or waking"},
+	{'X', "dead"},
+	{'I', "idle kernel thread"},
+	{'P', "parked kernel thread"},
+}
+
+// helpScreen is a Dialog that lists the key bindings, the columns and the
+// process states. The bindings are generated from Actions so that they
+// follow remapped keys.
+type helpScreen struct {
+	textView
+}
+
+// HandleHelp opens the help screen.
+func (ui *UI) HandleHelp() {
+	help := &helpScreen{textView{title: "Help (j/k to scroll, q to close)"}}
+
+	help.section("Keys")
+	help.lines = append(help.lines, bindingLines(ui.replay != nil)...)
+
+	help.section("Columns")
+	for _, column := range AllColumns {
+		help.addf("%-14s %s", column.Title, column.Description)
+	}
+
+	help.section("Process states")
+	for _, state := range States {
+		help.addf("%-14c %s", state.Letter, state.Description)
+	}
+	ui.OpenDialog(help)
+}
+
+// bindingLines returns a line for every action that's available when
+// replaying or not, with its keys and description.
+func bindingLines(replaying bool) []string {
+	var lines []string
+	for _, action := range Actions {
+		if action.Mode == liveMode && replaying || action.Mode == replayMode && !replaying {
+			continue
+		}
+		keys := strings.Join(action.Keys, ", ")
+		if keys == "" {
+			keys = "(unbound)"
+		}
+		lines = append(lines, fmt.Sprintf("%-14s %s", keys, action.Description))
+	}
+	return lines
+}
+
+func (help *helpScreen) Draw(ui *UI) {
+	help.draw(ui)
+}
+
+func (help *helpScreen) HandleKey(ui *UI, ev termbox.Event) bool {
+	if help.handleScrollKey(ui, ev) {
+		return true
+	}
+	return !(ev.Ch == 'q' || ev.Ch == '?' || ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyF1)
+}
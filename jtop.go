@@ -24,23 +24,69 @@ const (
 const usage = `Usage: jtop [options]
 
 Options:
-  -d, --delay    set delay between updates
-  -k, --kernel   show kernel threads
-  -p, --pids     filter by PID (comma-separated list)
-  -s, --sort     sort by the specified column
-  -t, --tree     display process list as tree
-  -u, --users    filter by User (comma-separated list)
-      --verbose  show full command line with arguments
+  -b, --batch       print snapshots to stdout instead of running interactively
+      --cgroup      also show the pressure of this cgroup v2 group
+      --config      read settings from this file (default ~/.config/jtop/config)
+  -d, --delay       set delay between updates
+      --filter      only show processes matching this expression, see Filters
+      --format      batch output format: text, csv or json (default text)
+  -n, --iterations  number of snapshots to print in batch mode (default unlimited)
+  -k, --kernel      show kernel threads
+      --listen      serve Prometheus metrics at /metrics on this address
+  -p, --pids        filter by PID (comma-separated list)
+      --proc-root   read process information from this directory (default /proc)
+      --record      append a snapshot to this file after every update
+      --replay      play back a file written by --record
+      --smaps       show PSS, USS, SWAP and SWAPPSS columns (slower)
+  -s, --sort        sort by the specified column
+      --theme       color theme: blue, default or mono (default default)
+  -H, --threads     show the threads of each process
+  -t, --tree        display process list as tree
+  -u, --users       filter by User (comma-separated list)
+      --verbose     show full command line with arguments
+
+Filters:
+  Compare fields with ==, !=, <, <=, > and >=, or match text fields against a
+  regular expression with ~ and !~. Combine comparisons with &&, || and !,
+  group them with parentheses and quote values that contain spaces. Sizes in
+  bytes may have a K, M or G suffix, e.g.
+
+    user==postgres && (cpu>5 || rss>1G) && cmd~"worker [0-9]+"
+
+  Text fields:    user, uid, name, cmd, state
+  Numeric fields: pid, ppid, cpu, mem, rss, time, nice, pri, io_r, io_w,
+                  pss, uss, swap (with --smaps), fds (with the FDS column),
+                  estab, listen, net_rx, net_tx (with their columns)
+
+Configuration:
+  Settings like the delay, sort order, columns and theme are read from the
+  --config file and options given on the command line override them. Press W
+  to write the current settings to it. Keys are remapped in its [keys] table,
+  e.g. select-first = ["g g", "home"]. Press ? or F1 in jtop for the actions,
+  the columns and the process states.
 `
 
 var (
-	delayFlag   time.Duration
-	kernelFlag  bool
-	pidsFlag    string
-	sortFlag    string
-	treeFlag    bool
-	usersFlag   string
-	verboseFlag bool
+	batchFlag      bool
+	cgroupFlag     string
+	configFlag     string
+	delayFlag      time.Duration
+	filterFlag     string
+	formatFlag     string
+	iterationsFlag int
+	kernelFlag     bool
+	listenFlag     string
+	pidsFlag       string
+	procRootFlag   string
+	recordFlag     string
+	replayFlag     string
+	smapsFlag      bool
+	sortFlag       string
+	themeFlag      string
+	threadsFlag    bool
+	treeFlag       bool
+	usersFlag      string
+	verboseFlag    bool
 )
 
 func exitf(format string, a ...interface{}) {
@@ -54,12 +100,51 @@ func signalSelf(sig syscall.Signal) {
 	}
 }
 
+func validateCgroupFlag() {
+	if cgroupFlag == "" {
+		return
+	}
+	info, err := os.Stat(cgroupPath(cgroupFlag))
+	if err != nil {
+		exitf("%s", err)
+	}
+	if !info.IsDir() {
+		exitf("%s is not a directory", cgroupFlag)
+	}
+}
+
 func validateDelayFlag() {
 	if delayFlag <= 0 {
 		exitf("delay (%s) must be positive", delayFlag)
 	}
 }
 
+func validateFilterFlag() {
+	if filterFlag == "" {
+		return
+	}
+	filter, err := ParseFilter(filterFlag)
+	if err != nil {
+		exitf("invalid filter: %s", err)
+	}
+	ProcessFilter = filter
+}
+
+func validateFormatFlag() {
+	for _, format := range Formats {
+		if formatFlag == format {
+			return
+		}
+	}
+	exitf("%s is not a valid format", formatFlag)
+}
+
+func validateIterationsFlag() {
+	if iterationsFlag < 0 {
+		exitf("iterations (%d) must not be negative", iterationsFlag)
+	}
+}
+
 func validatePidsFlag() {
 	if pidsFlag == "" {
 		return
@@ -75,13 +160,53 @@ func validatePidsFlag() {
 	}
 }
 
+func validateProcRootFlag() {
+	info, err := os.Stat(procRootFlag)
+	if err != nil {
+		exitf("%s", err)
+	}
+	if !info.IsDir() {
+		exitf("%s is not a directory", procRootFlag)
+	}
+}
+
+func validateReplayFlag() {
+	if replayFlag == "" {
+		return
+	}
+	if recordFlag != "" || batchFlag || listenFlag != "" {
+		exitf("--replay can't be combined with --record, --batch or --listen")
+	}
+}
+
+func validateSmapsFlag() {
+	if !smapsFlag || smapsShown() {
+		return
+	}
+	// After %MEM, or before COMMAND if %MEM is hidden.
+	i := shownColumnIndex(MemPercentColumn.Title) + 1
+	if i == 0 {
+		i = len(Columns) - 1
+	}
+	columns := append([]*Column{}, Columns[:i]...)
+	columns = append(columns, SmapsColumns...)
+	Columns = append(columns, Columns[i:]...)
+}
+
 func validateSortFlag() {
-	for _, column := range Columns {
-		if sortFlag == column.Title {
-			return
-		}
+	// Like Arrange, any column can be sorted by, shown or not.
+	if ColumnByTitle(sortFlag) == nil {
+		exitf("%s is not a valid sort column", sortFlag)
+	}
+}
+
+func validateThemeFlag() {
+	theme, ok := Themes[themeFlag]
+	if !ok {
+		exitf("%s is not a theme, choose from %s", themeFlag,
+			strings.Join(themeNames(), ", "))
 	}
-	exitf("%s is not a valid sort column", sortFlag)
+	useTheme(theme)
 }
 
 func validateUsersFlag() {
@@ -100,27 +225,63 @@ func validateUsersFlag() {
 }
 
 func validateFlags() {
+	validateCgroupFlag()
 	validateDelayFlag()
+	validateFilterFlag()
+	validateFormatFlag()
+	validateIterationsFlag()
 	validatePidsFlag()
+	validateProcRootFlag()
+	validateReplayFlag()
+	validateSmapsFlag()
 	validateSortFlag()
+	validateThemeFlag()
 	validateUsersFlag()
 }
 
 func init() {
+	flag.BoolVar(&batchFlag, "b", false, "")
+	flag.BoolVar(&batchFlag, "batch", false, "")
+
+	flag.StringVar(&cgroupFlag, "cgroup", "", "")
+
 	defaultDelay := time.Duration(1500 * time.Millisecond)
+	flag.StringVar(&configFlag, "config", defaultConfigPath(), "")
+
 	flag.DurationVar(&delayFlag, "d", defaultDelay, "")
 	flag.DurationVar(&delayFlag, "delay", defaultDelay, "")
 
+	flag.StringVar(&filterFlag, "filter", "", "")
+
+	flag.StringVar(&formatFlag, "format", TextFormat, "")
+
+	flag.IntVar(&iterationsFlag, "n", 0, "")
+	flag.IntVar(&iterationsFlag, "iterations", 0, "")
+
 	flag.BoolVar(&kernelFlag, "k", false, "")
 	flag.BoolVar(&kernelFlag, "kernel", false, "")
 
+	flag.StringVar(&listenFlag, "listen", "", "")
+
 	flag.StringVar(&pidsFlag, "p", "", "")
 	flag.StringVar(&pidsFlag, "pids", "", "")
 
+	flag.StringVar(&procRootFlag, "proc-root", "/proc", "")
+
+	flag.StringVar(&recordFlag, "record", "", "")
+	flag.StringVar(&replayFlag, "replay", "", "")
+
+	flag.BoolVar(&smapsFlag, "smaps", false, "")
+
 	defaultSort := CPUPercentColumn.Title
 	flag.StringVar(&sortFlag, "s", defaultSort, "")
 	flag.StringVar(&sortFlag, "sort", defaultSort, "")
 
+	flag.StringVar(&themeFlag, "theme", "default", "")
+
+	flag.BoolVar(&threadsFlag, "H", false, "")
+	flag.BoolVar(&threadsFlag, "threads", false, "")
+
 	flag.BoolVar(&treeFlag, "t", false, "")
 	flag.BoolVar(&treeFlag, "tree", false, "")
 
@@ -143,8 +304,57 @@ func termboxInit() {
 
 func main() {
 	flag.Parse()
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if err := LoadConfig(configFlag, given); err != nil {
+		exitf("%s", err)
+	}
 	validateFlags()
 
+	var monitor *Monitor
+	var replay *Replay
+	if replayFlag != "" {
+		var err error
+		if replay, err = LoadReplay(replayFlag); err != nil {
+			exitf("%s", err)
+		}
+		monitor = replay.Monitor()
+		monitor.Filter = ProcessFilter
+		monitor.Arrange()
+	} else {
+		var err error
+		if monitor, err = NewMonitor(procRootFlag); err != nil {
+			exitf("%s", err)
+		}
+		monitor.Cgroup = cgroupPath(cgroupFlag)
+		monitor.Filter = ProcessFilter
+		if recordFlag != "" {
+			if monitor.Recorder, err = NewRecorder(recordFlag); err != nil {
+				exitf("%s", err)
+			}
+			defer monitor.Recorder.Close()
+		}
+		if err := monitor.Update(); err != nil {
+			exitf("%s", err)
+		}
+	}
+
+	if listenFlag != "" {
+		exporter := NewExporter(monitor)
+		if err := exporter.ListenAndServe(listenFlag); err != nil {
+			exitf("%s", err)
+		}
+		return
+	}
+
+	if batchFlag {
+		batch := NewBatch(monitor, os.Stdout, formatFlag)
+		if err := batch.Run(delayFlag, iterationsFlag); err != nil {
+			exitf("%s", err)
+		}
+		return
+	}
+
 	termboxInit()
 	defer termbox.Close()
 
@@ -155,53 +365,36 @@ func main() {
 		}
 	}()
 
+	s := &session{
+		ui:      NewUI(monitor, replay),
+		monitor: monitor,
+		replay:  replay,
+	}
+
 	ticker := time.Tick(delayFlag)
-	monitor := NewMonitor()
-	monitor.Update()
-	ui := NewUI(monitor)
+	if replay != nil {
+		s.replayTimer = time.NewTimer(replay.Wait())
+		ticker = s.replayTimer.C
+	}
 
-	for {
-		ui.Draw()
+	for !s.quit {
+		s.ui.Draw()
 
 		select {
 		case <-ticker:
+			if replay != nil {
+				replay.Next()
+				s.scheduleReplay()
+				continue
+			}
+			// Errors are recorded by Monitor and shown in the status bar.
 			monitor.Update()
 
 		case ev := <-events:
-			if ev.Type == termbox.EventKey {
-				switch {
-				case ev.Ch == 'q' || ev.Key == termbox.KeyCtrlC:
-					return
-				case ev.Ch == 'h' || ev.Key == termbox.KeyArrowLeft:
-					ui.HandleLeft()
-				case ev.Ch == 'j' || ev.Key == termbox.KeyArrowDown:
-					ui.HandleDown()
-				case ev.Ch == 'k' || ev.Key == termbox.KeyArrowUp:
-					ui.HandleUp()
-				case ev.Ch == 'l' || ev.Key == termbox.KeyArrowRight:
-					ui.HandleRight()
-				case ev.Ch == '0' || ev.Ch == '^':
-					ui.HandleResetOffset()
-				case ev.Ch == 'g':
-					ui.HandleSelectFirst()
-				case ev.Ch == 'G':
-					ui.HandleSelectLast()
-				case ev.Ch == 't':
-					treeFlag = !treeFlag
-					monitor.Update()
-				case ev.Ch == 'v':
-					verboseFlag = !verboseFlag
-				case ev.Key == termbox.KeyCtrlD:
-					ui.HandleCtrlD()
-				case ev.Key == termbox.KeyCtrlU:
-					ui.HandleCtrlU()
-				case ev.Key == termbox.KeyCtrlZ:
-					termbox.Close()
-					signalSelf(syscall.SIGTSTP)
-					termboxInit()
-				}
+			if ev.Type == termbox.EventKey && !s.ui.HandleDialogKey(ev) {
+				s.HandleKey(ev)
 			} else if ev.Type == termbox.EventResize {
-				ui.HandleResize(ev.Width, ev.Height)
+				s.ui.HandleResize(ev.Width, ev.Height)
 			}
 		}
 	}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// actionMode says whether an Action is available when monitoring the
+// system, when replaying a recording or both.
+type actionMode int
+
+const (
+	anyMode actionMode = iota
+	liveMode
+	replayMode
+)
+
+// An Action is a command of the interactive session that can be bound to
+// keys.
+type Action struct {
+	Name        string
+	Description string
+	Mode        actionMode
+
+	// Keys are the key sequences bound to the action, like "g", "C-d",
+	// "f9" or "g g". They can be remapped in the [keys] table of the
+	// configuration file.
+	Keys []string
+
+	Run func(s *session)
+
+	defaultKeys []string
+}
+
+// Actions are all the actions, in the order they're listed in the help.
+// They're set in init as some of them refer back to Actions.
+var Actions []*Action
+
+func init() {
+	Actions = []*Action{
+		{Name: "select-up", Description: "select the process above", Keys: []string{"k", "up"},
+			Run: func(s *session) { s.ui.HandleUp() }},
+		{Name: "select-down", Description: "select the process below", Keys: []string{"j", "down"},
+			Run: func(s *session) { s.ui.HandleDown() }},
+		{Name: "page-up", Description: "move up half a screen", Keys: []string{"C-u", "pgup"},
+			Run: func(s *session) { s.ui.HandleCtrlU() }},
+		{Name: "page-down", Description: "move down half a screen", Keys: []string{"C-d", "pgdn"},
+			Run: func(s *session) { s.ui.HandleCtrlD() }},
+		{Name: "select-first", Description: "select the first process", Keys: []string{"g", "home"},
+			Run: func(s *session) { s.ui.HandleSelectFirst() }},
+		{Name: "select-last", Description: "select the last process", Keys: []string{"G", "end"},
+			Run: func(s *session) { s.ui.HandleSelectLast() }},
+		{Name: "scroll-left", Description: "scroll the process list left", Keys: []string{"h", "left"},
+			Run: func(s *session) { s.ui.HandleLeft() }},
+		{Name: "scroll-right", Description: "scroll the process list right", Keys: []string{"l", "right"},
+			Run: func(s *session) { s.ui.HandleRight() }},
+		{Name: "scroll-reset", Description: "scroll back to the first column", Keys: []string{"0", "^"},
+			Run: func(s *session) { s.ui.HandleResetOffset() }},
+
+		{Name: "details", Description: "show details of the selected process", Keys: []string{"enter"},
+			Run: func(s *session) { s.ui.HandleDetail() }},
+
+		{Name: "search", Description: "search or filter by command", Keys: []string{"/"},
+			Run: func(s *session) { s.ui.HandleSearch() }},
+		{Name: "search-next", Description: "select the next match", Keys: []string{"n"},
+			Run: func(s *session) { s.ui.HandleNextMatch(1) }},
+		{Name: "search-previous", Description: "select the previous match", Keys: []string{"N"},
+			Run: func(s *session) { s.ui.HandleNextMatch(-1) }},
+		{Name: "search-clear", Description: "clear the search", Keys: []string{"esc"},
+			Run: func(s *session) { s.ui.HandleClearSearch() }},
+		{Name: "filter", Description: "edit the filter expression", Keys: []string{"f"},
+			Run: func(s *session) { s.ui.HandleFilter() }},
+
+		{Name: "toggle-tree", Description: "show processes as a tree", Keys: []string{"t"},
+			Run: func(s *session) { treeFlag = !treeFlag; s.monitor.Arrange() }},
+		{Name: "toggle-threads", Description: "show threads", Keys: []string{"H"},
+			Run: (*session).toggleThreads},
+		{Name: "toggle-verbose", Description: "show full command lines", Keys: []string{"v"},
+			Run: func(s *session) { verboseFlag = !verboseFlag }},
+		{Name: "columns", Description: "show, hide and reorder columns", Keys: []string{"C", "f2"},
+			Run: func(s *session) { s.ui.HandleColumns() }},
+		{Name: "sort", Description: "pick the sort columns", Keys: []string{"o", "f6"},
+			Run: func(s *session) { s.ui.HandleSort() }},
+		{Name: "sort-previous", Description: "sort by the column to the left", Keys: []string{"<"},
+			Run: func(s *session) { s.ui.HandleSortNext(-1) }},
+		{Name: "sort-next", Description: "sort by the column to the right", Keys: []string{">"},
+			Run: func(s *session) { s.ui.HandleSortNext(1) }},
+		{Name: "sort-reverse", Description: "invert the sort order", Keys: []string{"I"},
+			Run: func(s *session) { s.ui.HandleSortReverse() }},
+		{Name: "save-config", Description: "write the settings to the config file", Keys: []string{"W"},
+			Run: func(s *session) { s.ui.HandleSaveConfig() }},
+
+		{Name: "tag", Description: "tag or untag the selected process", Mode: liveMode, Keys: []string{"space"},
+			Run: func(s *session) { s.ui.HandleTag() }},
+		{Name: "untag-all", Description: "untag all processes", Keys: []string{"U"},
+			Run: func(s *session) { s.ui.HandleUntagAll() }},
+		{Name: "signal", Description: "send a signal", Mode: liveMode, Keys: []string{"K", "f9"},
+			Run: func(s *session) { s.ui.HandleSignal() }},
+		{Name: "nice-lower", Description: "raise the priority (lower nice)", Mode: liveMode, Keys: []string{"]", "f7"},
+			Run: func(s *session) { s.ui.HandleNice(-1) }},
+		{Name: "nice-higher", Description: "lower the priority (higher nice)", Mode: liveMode, Keys: []string{"[", "f8"},
+			Run: func(s *session) { s.ui.HandleNice(1) }},
+		{Name: "io-priority", Description: "set the I/O priority", Mode: liveMode, Keys: []string{"i"},
+			Run: func(s *session) { s.ui.HandleIOPriority() }},
+
+		{Name: "replay-pause", Description: "pause or resume the replay", Mode: replayMode, Keys: []string{"space"},
+			Run: func(s *session) { s.replay.TogglePause(); s.scheduleReplay() }},
+		{Name: "replay-next", Description: "step to the next snapshot", Mode: replayMode, Keys: []string{"."},
+			Run: func(s *session) { s.replay.Paused = true; s.replay.Next(); s.scheduleReplay() }},
+		{Name: "replay-previous", Description: "step to the previous snapshot", Mode: replayMode, Keys: []string{","},
+			Run: func(s *session) { s.replay.Paused = true; s.replay.Prev(); s.scheduleReplay() }},
+		{Name: "replay-faster", Description: "replay faster", Mode: replayMode, Keys: []string{"+"},
+			Run: func(s *session) { s.replay.Faster(); s.scheduleReplay() }},
+		{Name: "replay-slower", Description: "replay slower", Mode: replayMode, Keys: []string{"-"},
+			Run: func(s *session) { s.replay.Slower(); s.scheduleReplay() }},
+
+		{Name: "help", Description: "show this help", Keys: []string{"?", "f1"},
+			Run: func(s *session) { s.ui.HandleHelp() }},
+		{Name: "suspend", Description: "suspend jtop", Keys: []string{"C-z"},
+			Run: (*session).suspend},
+		{Name: "quit", Description: "quit", Keys: []string{"q", "C-c"},
+			Run: func(s *session) { s.quit = true }},
+	}
+
+	for _, action := range Actions {
+		action.defaultKeys = action.Keys
+	}
+}
+
+// FindAction returns the Action called name, or nil if there isn't one.
+func FindAction(name string) *Action {
+	for _, action := range Actions {
+		if action.Name == name {
+			return action
+		}
+	}
+	return nil
+}
+
+// keyNames are the names of the keys that aren't characters.
+var keyNames = map[termbox.Key]string{
+	termbox.KeyF1:         "f1",
+	termbox.KeyF2:         "f2",
+	termbox.KeyF3:         "f3",
+	termbox.KeyF4:         "f4",
+	termbox.KeyF5:         "f5",
+	termbox.KeyF6:         "f6",
+	termbox.KeyF7:         "f7",
+	termbox.KeyF8:         "f8",
+	termbox.KeyF9:         "f9",
+	termbox.KeyF10:        "f10",
+	termbox.KeyF11:        "f11",
+	termbox.KeyF12:        "f12",
+	termbox.KeyInsert:     "insert",
+	termbox.KeyDelete:     "delete",
+	termbox.KeyHome:       "home",
+	termbox.KeyEnd:        "end",
+	termbox.KeyPgup:       "pgup",
+	termbox.KeyPgdn:       "pgdn",
+	termbox.KeyArrowUp:    "up",
+	termbox.KeyArrowDown:  "down",
+	termbox.KeyArrowLeft:  "left",
+	termbox.KeyArrowRight: "right",
+	termbox.KeyBackspace:  "backspace",
+	termbox.KeyBackspace2: "backspace",
+	termbox.KeyTab:        "tab",
+	termbox.KeyEnter:      "enter",
+	termbox.KeyEsc:        "esc",
+	termbox.KeySpace:      "space",
+}
+
+// keyName returns the name of the key pressed in ev as used in Action.Keys,
+// or "" if it can't be bound.
+func keyName(ev termbox.Event) string {
+	if ev.Ch != 0 {
+		return string(ev.Ch)
+	}
+	if name, ok := keyNames[ev.Key]; ok {
+		return name
+	}
+	if ev.Key >= termbox.KeyCtrlA && ev.Key <= termbox.KeyCtrlZ {
+		return "C-" + string(rune('a'+ev.Key-termbox.KeyCtrlA))
+	}
+	return ""
+}
+
+// validateKeySequence returns an error if a key in the sequence, separated
+// by spaces, has no name.
+func validateKeySequence(sequence string) error {
+	keys := strings.Fields(sequence)
+	if len(keys) == 0 {
+		return fmt.Errorf("empty key sequence")
+	}
+	for _, key := range keys {
+		if len([]rune(key)) == 1 {
+			continue
+		}
+		if len(key) == 3 && strings.HasPrefix(key, "C-") && key[2] >= 'a' && key[2] <= 'z' {
+			// Terminals send some control keys as other keys, like C-i
+			// as tab, and keyName reports those.
+			if name, ok := keyNames[termbox.KeyCtrlA+termbox.Key(key[2]-'a')]; ok {
+				return fmt.Errorf("%s is the same key as %s", key, name)
+			}
+			continue
+		}
+		known := false
+		for _, name := range keyNames {
+			known = known || key == name
+		}
+		if !known {
+			return fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return nil
+}
+
+// validateKeyBindings returns an error if a key sequence is bound twice,
+// or starts a longer one, among the actions available at the same time.
+// Typing the shorter sequence would wait for the next key forever.
+func validateKeyBindings() error {
+	type binding struct {
+		action   *Action
+		sequence string
+	}
+	var bindings []binding
+	for _, action := range Actions {
+		for _, sequence := range action.Keys {
+			bindings = append(bindings, binding{action, strings.Join(strings.Fields(sequence), " ")})
+		}
+	}
+
+	for i, a := range bindings {
+		for _, b := range bindings[i+1:] {
+			if a.action.Mode != anyMode && b.action.Mode != anyMode && a.action.Mode != b.action.Mode {
+				continue
+			}
+			switch {
+			case a.sequence == b.sequence:
+				return fmt.Errorf("%q is bound to both %s and %s", a.sequence, a.action.Name, b.action.Name)
+			case strings.HasPrefix(b.sequence, a.sequence+" "):
+				return fmt.Errorf("%q of %s starts %q of %s", a.sequence, a.action.Name, b.sequence, b.action.Name)
+			case strings.HasPrefix(a.sequence, b.sequence+" "):
+				return fmt.Errorf("%q of %s starts %q of %s", b.sequence, b.action.Name, a.sequence, a.action.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// session is the state of the interactive loop that actions act on.
+type session struct {
+	ui      *UI
+	monitor *Monitor
+	replay  *Replay
+
+	replayTimer *time.Timer
+	quit        bool
+
+	// pending are the keys typed so far of a key sequence.
+	pending []string
+}
+
+// HandleKey runs the action bound to the key sequence that ends with ev.
+// If the keys typed so far start a longer sequence, it waits for the next
+// key. validateKeyBindings makes sure that a complete sequence doesn't
+// start another one.
+func (s *session) HandleKey(ev termbox.Event) {
+	name := keyName(ev)
+	if name == "" {
+		return
+	}
+	s.pending = append(s.pending, name)
+
+	action, more := s.lookup(s.pending)
+	if more {
+		return
+	}
+	pending := s.pending
+	s.pending = nil
+	if action != nil {
+		action.Run(s)
+		return
+	}
+
+	// Nothing starts with the whole sequence, the last key may start a
+	// new one.
+	if len(pending) > 1 {
+		s.HandleKey(ev)
+	}
+}
+
+// lookup returns the action bound to keys, if any, and whether keys is
+// the start of a longer sequence.
+func (s *session) lookup(keys []string) (*Action, bool) {
+	typed := strings.Join(keys, " ")
+	var found *Action
+	var more bool
+	for _, action := range Actions {
+		if action.Mode == liveMode && s.replay != nil || action.Mode == replayMode && s.replay == nil {
+			continue
+		}
+		for _, sequence := range action.Keys {
+			sequence = strings.Join(strings.Fields(sequence), " ")
+			if sequence == typed && found == nil {
+				found = action
+			} else if strings.HasPrefix(sequence, typed+" ") {
+				more = true
+			}
+		}
+	}
+	return found, more
+}
+
+// scheduleReplay restarts the wait for the next snapshot after the
+// position, speed or paused state of the replay changed.
+func (s *session) scheduleReplay() {
+	if !s.replayTimer.Stop() {
+		select {
+		case <-s.replayTimer.C:
+		default:
+		}
+	}
+	if !s.replay.Paused {
+		s.replayTimer.Reset(s.replay.Wait())
+	}
+}
+
+func (s *session) toggleThreads() {
+	threadsFlag = !threadsFlag
+	if s.replay != nil {
+		s.replay.Reload()
+	} else {
+		s.monitor.Update()
+	}
+}
+
+func (s *session) suspend() {
+	termbox.Close()
+	signalSelf(syscall.SIGTSTP)
+	termboxInit()
+}
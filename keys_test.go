@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestValidateKeySequence(t *testing.T) {
+	for _, sequence := range []string{"g", "g g", "C-d", "f9", "space"} {
+		if err := validateKeySequence(sequence); err != nil {
+			t.Errorf("validateKeySequence(%q): %v", sequence, err)
+		}
+	}
+	// C-h, C-i and C-m arrive as backspace, tab and enter.
+	for _, sequence := range []string{"", "C-h", "C-i", "C-m", "g C-i", "ctrl-x"} {
+		if err := validateKeySequence(sequence); err == nil {
+			t.Errorf("validateKeySequence(%q) succeeded", sequence)
+		}
+	}
+}
+
+func TestValidateKeyBindings(t *testing.T) {
+	defer func() {
+		for _, action := range Actions {
+			action.Keys = action.defaultKeys
+		}
+	}()
+
+	if err := validateKeyBindings(); err != nil {
+		t.Fatalf("default bindings: %v", err)
+	}
+
+	tests := []struct {
+		action string
+		keys   []string
+		ok     bool
+	}{
+		// g is bound to select-first.
+		{"select-last", []string{"g g"}, false},
+		{"select-last", []string{"g"}, false},
+		{"select-last", []string{"G G"}, true},
+		// Only one of these is available at a time.
+		{"replay-pause", []string{"space"}, true},
+		{"replay-next", []string{"i"}, true},
+	}
+	for _, test := range tests {
+		action := FindAction(test.action)
+		action.Keys = test.keys
+		err := validateKeyBindings()
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s = %q: %v", test.action, test.keys, err)
+		}
+		action.Keys = action.defaultKeys
+	}
+}
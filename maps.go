@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// A memoryMapping is a region of /proc/<pid>/smaps, or all the regions of
+// a backing file when grouped. The sizes are in bytes.
+type memoryMapping struct {
+	Start   uint64
+	End     uint64
+	Perms   string // rwxp
+	Path    string // backing file, or like [heap], or empty if anonymous
+	Regions int
+
+	Size         uint64
+	RSS          uint64
+	PSS          uint64
+	PrivateDirty uint64
+	Swap         uint64
+}
+
+// mappingSorts are the orders that the memory maps view cycles through.
+// Address is ascending and the sizes are descending.
+var mappingSorts = []struct {
+	Name  string
+	Value func(m *memoryMapping) uint64
+}{
+	{"address", func(m *memoryMapping) uint64 { return m.Start }},
+	{"size", func(m *memoryMapping) uint64 { return m.Size }},
+	{"rss", func(m *memoryMapping) uint64 { return m.RSS }},
+	{"pss", func(m *memoryMapping) uint64 { return m.PSS }},
+	{"dirty", func(m *memoryMapping) uint64 { return m.PrivateDirty }},
+	{"swap", func(m *memoryMapping) uint64 { return m.Swap }},
+}
+
+// parseSmapsFile returns the regions of a smaps file in address order.
+func parseSmapsFile(path string) ([]*memoryMapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every region starts with its maps line, "7f2c4a000000-7f2c4a021000
+	// rw-p 00000000 00:00 0   [heap]", followed by "Rss:   132 kB" lines.
+	var mappings []*memoryMapping
+	var m *memoryMapping
+	for _, line := range strings.Split(string(data), "\n") {
+		values := strings.Fields(line)
+		if len(values) == 0 {
+			continue
+		}
+
+		if !strings.HasSuffix(values[0], ":") {
+			if len(values) < 5 {
+				return nil, fmt.Errorf("malformed %s: %q", path, line)
+			}
+			bounds := strings.Split(values[0], "-")
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("malformed %s: %q", path, line)
+			}
+			m = &memoryMapping{Perms: values[1], Regions: 1}
+			if m.Start, err = strconv.ParseUint(bounds[0], 16, 64); err != nil {
+				return nil, fmt.Errorf("malformed %s: %v", path, err)
+			}
+			if m.End, err = strconv.ParseUint(bounds[1], 16, 64); err != nil {
+				return nil, fmt.Errorf("malformed %s: %v", path, err)
+			}
+			m.Path = strings.Join(values[5:], " ")
+			mappings = append(mappings, m)
+			continue
+		}
+
+		if m == nil || len(values) != 3 || values[2] != "kB" {
+			continue
+		}
+		var field *uint64
+		switch values[0] {
+		case "Size:":
+			field = &m.Size
+		case "Rss:":
+			field = &m.RSS
+		case "Pss:":
+			field = &m.PSS
+		case "Private_Dirty:":
+			field = &m.PrivateDirty
+		case "Swap:":
+			field = &m.Swap
+		default:
+			continue
+		}
+		kb, err := ParseUint64(values[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s: %v", path, err)
+		}
+		*field = kb * KB
+	}
+	return mappings, nil
+}
+
+// groupMappings sums the regions of each backing file. Anonymous regions
+// are summed together.
+func groupMappings(mappings []*memoryMapping) []*memoryMapping {
+	var groups []*memoryMapping
+	byPath := make(map[string]*memoryMapping)
+	for _, m := range mappings {
+		g, ok := byPath[m.Path]
+		if !ok {
+			g = &memoryMapping{Start: m.Start, End: m.End, Path: m.Path}
+			byPath[m.Path] = g
+			groups = append(groups, g)
+		}
+		g.Regions++
+		g.Size += m.Size
+		g.RSS += m.RSS
+		g.PSS += m.PSS
+		g.PrivateDirty += m.PrivateDirty
+		g.Swap += m.Swap
+	}
+	return groups
+}
+
+// mappingName returns the backing file of m, or [anon].
+func mappingName(m *memoryMapping) string {
+	if m.Path == "" {
+		return "[anon]"
+	}
+	return m.Path
+}
+
+// mapsView lists the memory mappings of the detail view's process, one
+// per region or summed per backing file, in one of the mappingSorts.
+type mapsView struct {
+	detailSubview
+
+	// sortBy is the index in mappingSorts. grouped sums the regions of
+	// each backing file.
+	sortBy  int
+	grouped bool
+}
+
+func (v *mapsView) Draw(ui *UI) {
+	v.drawRefreshed(ui, v.refresh)
+}
+
+func (v *mapsView) HandleKey(ui *UI, ev termbox.Event) bool {
+	if v.handleBackKey(ui, ev) {
+		return true
+	}
+	switch ev.Ch {
+	case 's':
+		v.sortBy = (v.sortBy + 1) % len(mappingSorts)
+		v.lines = nil
+	case 'f':
+		v.grouped = !v.grouped
+		v.lines = nil
+	}
+	return true
+}
+
+func (v *mapsView) refresh() {
+	p := v.back.process
+	v.reset()
+	order := mappingSorts[v.sortBy]
+	v.title = fmt.Sprintf("Memory maps of %v by %s (s: sort, f: group by file, q: go back)",
+		p, order.Name)
+
+	if p.dir == "" {
+		v.addf("Memory maps aren't recorded.")
+		return
+	}
+	mappings, err := parseSmapsFile(filepath.Join(p.dir, "smaps"))
+	if err != nil {
+		v.addf("%v", err)
+		return
+	}
+
+	total := &memoryMapping{Regions: len(mappings)}
+	for _, m := range mappings {
+		total.Size += m.Size
+		total.RSS += m.RSS
+		total.PSS += m.PSS
+		total.PrivateDirty += m.PrivateDirty
+		total.Swap += m.Swap
+	}
+	if v.grouped {
+		mappings = groupMappings(mappings)
+	}
+	if v.sortBy > 0 {
+		sort.SliceStable(mappings, func(i, j int) bool {
+			return order.Value(mappings[i]) > order.Value(mappings[j])
+		})
+	}
+
+	v.addf("%d regions  size %s  rss %s  pss %s  dirty %s  swap %s",
+		total.Regions, formatBytes(total.Size), formatBytes(total.RSS),
+		formatBytes(total.PSS), formatBytes(total.PrivateDirty),
+		formatBytes(total.Swap))
+	v.addf("")
+
+	format := "%-25s %-4s %7s %7s %7s %7s %7s  %s"
+	if v.grouped {
+		v.addf(format, "FIRST ADDRESS", "MAPS", "SIZE", "RSS", "PSS", "DIRTY",
+			"SWAP", "FILE")
+	} else {
+		v.addf(format, "ADDRESS", "PERM", "SIZE", "RSS", "PSS", "DIRTY",
+			"SWAP", "FILE")
+	}
+	for _, m := range mappings {
+		address := fmt.Sprintf("%012x-%012x", m.Start, m.End)
+		perms := m.Perms
+		if v.grouped {
+			address = fmt.Sprintf("%012x", m.Start)
+			perms = strconv.Itoa(m.Regions)
+		}
+		v.addf(format, address, perms, formatBytes(m.Size), formatBytes(m.RSS),
+			formatBytes(m.PSS), formatBytes(m.PrivateDirty),
+			formatBytes(m.Swap), mappingName(m))
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MemInfo contains the memory and swap usage from /proc/meminfo, in bytes
+// except for the HugePages counts.
+type MemInfo struct {
+	MemTotal     uint64
+	MemFree      uint64
+	MemAvailable uint64
+	Buffers      uint64
+	Cached       uint64
+	Shmem        uint64
+	SwapTotal    uint64
+	SwapFree     uint64
+	Dirty        uint64
+	Writeback    uint64
+
+	HugePagesTotal uint64
+	HugePagesFree  uint64
+	HugePageSize   uint64
+}
+
+// MemUsed returns the memory that can't be made available without
+// swapping.
+func (mi MemInfo) MemUsed() uint64 {
+	if mi.MemAvailable > mi.MemTotal {
+		return 0
+	}
+	return mi.MemTotal - mi.MemAvailable
+}
+
+// SwapUsed returns the swap space in use.
+func (mi MemInfo) SwapUsed() uint64 {
+	if mi.SwapFree > mi.SwapTotal {
+		return 0
+	}
+	return mi.SwapTotal - mi.SwapFree
+}
+
+// parseMeminfo parses the contents of /proc/meminfo. Fields that are
+// missing, e.g. MemAvailable before Linux 3.14, are left zero.
+func parseMeminfo(r io.Reader) (MemInfo, error) {
+	var mi MemInfo
+	fields := map[string]*uint64{
+		"MemTotal":        &mi.MemTotal,
+		"MemFree":         &mi.MemFree,
+		"MemAvailable":    &mi.MemAvailable,
+		"Buffers":         &mi.Buffers,
+		"Cached":          &mi.Cached,
+		"Shmem":           &mi.Shmem,
+		"SwapTotal":       &mi.SwapTotal,
+		"SwapFree":        &mi.SwapFree,
+		"Dirty":           &mi.Dirty,
+		"Writeback":       &mi.Writeback,
+		"HugePages_Total": &mi.HugePagesTotal,
+		"HugePages_Free":  &mi.HugePagesFree,
+		"Hugepagesize":    &mi.HugePageSize,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// line = "MemTotal:       16371752 kB"
+		values := strings.Fields(scanner.Text())
+		if len(values) < 2 {
+			continue
+		}
+		name := strings.TrimSuffix(values[0], ":")
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		value, err := ParseUint64(values[1])
+		if err != nil {
+			return mi, fmt.Errorf("malformed %s: %v", name, err)
+		}
+		// As far as I know sizes are always expressed in KB.
+		if len(values) > 2 && values[2] == "kB" {
+			value *= KB
+		}
+		*field = value
+	}
+	return mi, scanner.Err()
+}
+
+// formatBytes formats a number of bytes like "512K", "1.5G".
+func formatBytes(b uint64) string {
+	units := []struct {
+		size   uint64
+		suffix string
+	}{{TB, "T"}, {GB, "G"}, {MB, "M"}}
+	for _, unit := range units {
+		if b >= unit.size {
+			return fmt.Sprintf("%.1f%s", float64(b)/float64(unit.size), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dK", b/KB)
+}
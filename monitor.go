@@ -6,14 +6,22 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 const (
 	InitPid     uint64 = 1
 	KthreaddPid uint64 = 2
+
+	// smapsEvery is how many Updates pass between reading the smaps of
+	// all processes, because that's expensive.
+	smapsEvery = 5
 )
 
 var (
@@ -35,42 +43,119 @@ func pidWhitelisted(pid uint64) bool {
 
 // Monitor monitors the processes and resource utilization of the system.
 type Monitor struct {
+	// ProcRoot is the mount point of the proc filesystem that every file
+	// is read from, usually "/proc".
+	ProcRoot string `json:"-"`
+
+	// Cgroup is the directory of a cgroup v2 group whose pressure is read
+	// into CgroupPSI, if set.
+	Cgroup string `json:"-"`
+
+	// Filter, if set, hides the processes that don't match it.
+	Filter *Filter `json:"-"`
+
+	// Recorder, if set, records a snapshot after every Update.
+	Recorder *Recorder `json:"-"`
+
+	// Time is when the last Update happened and Interval the time since
+	// the Update before it, zero after the first Update.
+	Time     time.Time
+	Interval time.Duration
+
 	List []*Process
-	Map  map[uint64]*Process
+	Map  map[uint64]*Process `json:"-"`
 
 	NumCPUs  int
 	MemTotal uint64
 	PageSize uint64
 
+	// Mem is the memory and swap usage as of the last Update.
+	Mem MemInfo
+
+	// LoadAvg is the 1, 5 and 15 minute load average.
+	LoadAvg [3]float64
+	Uptime  time.Duration
+
+	// PSI is the Pressure Stall Information of the system and CgroupPSI
+	// of Cgroup.
+	PSI       PSI
+	CgroupPSI PSI
+
 	CPUTimeTotal uint64
 	CPUTimeDiff  uint64
+
+	// CPU is the time spent in each state by all CPUs and CPUs by each
+	// CPU, since boot. CPUDiff and CPUsDiff are the same since the last
+	// Update.
+	CPU      CPUStat
+	CPUDiff  CPUStat
+	CPUs     []CPUStat
+	CPUsDiff []CPUStat
+
+	// SocketPids indexes the processes by the inodes of their sockets.
+	// netNamespaces is the traffic of each network namespace by inode. Both
+	// are only kept while one of the NetColumns is shown or sorted by.
+	SocketPids    map[uint64][]uint64 `json:"-"`
+	netNamespaces map[uint64]*netNamespace
+
+	// updates counts the calls to Update.
+	updates uint64
+
+	// Errors counts the failures encountered while sampling, LastErr is
+	// the most recent one.
+	Errors  uint64
+	LastErr error `json:"-"`
 }
 
-// NewMonitor returns an initialized Monitor.
-func NewMonitor() *Monitor {
+// NewMonitor returns an initialized Monitor that reads from the proc
+// filesystem mounted at procRoot.
+func NewMonitor(procRoot string) (*Monitor, error) {
 	m := &Monitor{
-		Map:     make(map[uint64]*Process),
-		NumCPUs: runtime.NumCPU(),
+		ProcRoot: procRoot,
+		Map:      make(map[uint64]*Process),
+		NumCPUs:  runtime.NumCPU(),
 	}
-	m.queryPageSize()
-	m.parseMeminfoFile()
-	return m
+	if err := m.queryPageSize(); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-// Update updates the Monitor state via the proc filesystem.
-func (m *Monitor) Update() {
-	lastCPUTimeTotal := m.CPUTimeTotal
-	m.parseStatFile()
-	m.CPUTimeDiff = m.CPUTimeTotal - lastCPUTimeTotal
+// Update updates the Monitor state via the proc filesystem. Processes that
+// fail to parse are skipped and recorded in Errors and LastErr. An error is
+// returned, and also recorded, if the update had to be abandoned.
+func (m *Monitor) Update() error {
+	if err := m.parseStatFile(); err != nil {
+		return m.recordError(err)
+	}
+	if err := m.parseMeminfoFile(); err != nil {
+		return m.recordError(err)
+	}
+	// The load average and uptime are only informational, e.g. a captured
+	// proc tree might not have them.
+	if err := m.parseLoadavgFile(); err != nil && !os.IsNotExist(err) {
+		m.recordError(err)
+	}
+	if err := m.parseUptimeFile(); err != nil && !os.IsNotExist(err) {
+		m.recordError(err)
+	}
+	if err := m.readPSI(); err != nil {
+		m.recordError(err)
+	}
+
+	entires, err := ioutil.ReadDir(m.ProcRoot)
+	if err != nil {
+		return m.recordError(err)
+	}
 
 	for _, p := range m.List {
 		p.Alive = false
 	}
 
-	entires, err := ioutil.ReadDir("/proc")
-	if err != nil {
-		panic(err)
-	}
+	m.updates++
+	smaps := anyColumnUsed(SmapsColumns)
+	fds := columnUsed(FDSColumn)
+	smapsDue := smaps && m.updates%smapsEvery == 1
 
 	for _, entry := range entires {
 		if !entry.IsDir() {
@@ -86,42 +171,134 @@ func (m *Monitor) Update() {
 			continue
 		}
 
-		if p, ok := m.Map[pid]; ok {
-			if err := p.Update(); err == nil {
-				p.Alive = true
-			}
-		} else if p := NewProcess(pid); p != nil {
-			if p.IsKernelThread() && !kernelFlag {
-				continue
+		p, isNew := m.updateProcess(m.procPath(entry.Name()), pid, pid)
+		if p == nil {
+			continue
+		}
+		if smapsDue || (smaps && isNew) {
+			if err := p.UpdateSmaps(); err != nil {
+				m.recordError(fmt.Errorf("%v: %v", p, err))
 			}
-			p.Alive = true
-			m.addProcess(p)
+		}
+		if fds {
+			p.UpdateFDs()
+		}
+		if threadsFlag {
+			m.updateThreads(p)
 		}
 	}
 
 	m.removeDeadProcesses()
+	if anyColumnUsed(NetColumns) {
+		m.updateNetwork()
+	} else {
+		m.SocketPids, m.netNamespaces = nil, nil
+	}
+
+	now := time.Now()
+	if !m.Time.IsZero() {
+		m.Interval = now.Sub(m.Time)
+	}
+	m.Time = now
+	m.Arrange()
+
+	if m.Recorder != nil {
+		if err := m.Recorder.Record(m); err != nil {
+			m.recordError(err)
+		}
+	}
+
+	return nil
+}
+
+// Arrange puts List in the order selected by the --sort and --tree options
+// and applies the Filter.
+func (m *Monitor) Arrange() {
+	for _, p := range m.List {
+		p.hidden = m.Filter != nil && !m.Filter.Match(m, p)
+	}
 
 	if treeFlag {
 		sort.Sort(ByPid(m.List))
 		m.associateProcesses()
 	} else {
-		switch sortFlag {
-		case PidColumn.Title:
-			sort.Sort(ByPid(m.List))
-		case UserColumn.Title:
-			sort.Sort(ByUser(m.List))
-		case RSSColumn.Title, MemPercentColumn.Title:
-			sort.Sort(ByRSS(m.List))
-		case CPUPercentColumn.Title:
-			sort.Sort(ByCPU(m.List))
-		case CPUTimeColumn.Title:
-			sort.Sort(ByTime(m.List))
-		case StateColumn.Title:
-			sort.Sort(ByState(m.List))
-		case CommandColumn.Title:
-			sort.Sort(ByName(m.List))
+		sort.Sort(BySort{
+			List:      m.List,
+			Column:    ColumnByTitle(sortFlag),
+			Reverse:   SortReverse,
+			Secondary: ColumnByTitle(SecondarySort),
+		})
+	}
+}
+
+// updateProcess updates the Process with pid from dir, or adds it if it's
+// new. tgid is the Pid of the process a thread belongs to, or pid itself
+// for processes. It returns the Process if it's alive and monitored, and
+// whether it was added.
+func (m *Monitor) updateProcess(dir string, pid, tgid uint64) (*Process, bool) {
+	if p, ok := m.Map[pid]; ok {
+		if err := p.Update(); err != nil {
+			if !processVanished(err) {
+				m.recordError(fmt.Errorf("%v: %v", p, err))
+			}
+			return nil, false
+		}
+		p.Alive = true
+		return p, false
+	}
+
+	p, err := NewProcess(dir, pid, tgid)
+	if err != nil {
+		if !processVanished(err) && err != ErrNotWhitelisted {
+			m.recordError(fmt.Errorf("%d: %v", pid, err))
 		}
+		return nil, false
 	}
+	if p.IsKernelThread() && !kernelFlag {
+		return nil, false
+	}
+	p.Alive = true
+	m.addProcess(p)
+	return p, true
+}
+
+// updateThreads updates the threads of p from /proc/<pid>/task, except for
+// the main thread which p itself represents.
+func (m *Monitor) updateThreads(p *Process) {
+	taskDir := filepath.Join(p.dir, "task")
+	entries, err := ioutil.ReadDir(taskDir)
+	if err != nil {
+		if !processVanished(err) {
+			m.recordError(fmt.Errorf("%v: %v", p, err))
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		tid, err := ParseUint64(entry.Name())
+		if err != nil || tid == p.Pid {
+			continue
+		}
+		m.updateProcess(filepath.Join(taskDir, entry.Name()), tid, p.Pid)
+	}
+}
+
+// recordError counts err and makes it the LastErr. It returns err.
+func (m *Monitor) recordError(err error) error {
+	m.Errors++
+	m.LastErr = err
+	return err
+}
+
+// processVanished returns whether err was caused by a process exiting
+// while it was being read.
+func processVanished(err error) bool {
+	return os.IsNotExist(err) || err == syscall.ESRCH
+}
+
+// procPath returns the path of a file relative to ProcRoot.
+func (m *Monitor) procPath(elem ...string) string {
+	return filepath.Join(append([]string{m.ProcRoot}, elem...)...)
 }
 
 func (m *Monitor) addProcess(p *Process) {
@@ -141,6 +318,9 @@ func (m *Monitor) removeDeadProcesses() {
 }
 
 // associateProcesses associates each Process with its Parent and Children.
+// A Process whose parent is unknown, because it's in another PID namespace,
+// filtered out or raced with us, is left without a Parent and becomes the
+// root of its own tree.
 func (m *Monitor) associateProcesses() {
 	for _, p := range m.List {
 		p.Parent = nil
@@ -148,78 +328,232 @@ func (m *Monitor) associateProcesses() {
 	}
 
 	for _, p := range m.List {
-		if parent, ok := m.Map[p.Ppid]; ok {
+		// Threads are shown as children of their process, their Ppid is
+		// the parent of their process.
+		ppid := p.Ppid
+		if p.IsThread() {
+			ppid = p.Tgid
+		}
+		if parent, ok := m.Map[ppid]; ok && parent != p {
 			p.Parent = parent
 			parent.Children = append(parent.Children, p)
-		} else if p.Pid != InitPid && p.Pid != KthreaddPid {
-			// init (1) and kthreadd (2) are the only processes that should
-			// have no parent.
-			panic(fmt.Sprintf("process %v has parent %d that we're unaware of",
-				p, p.Ppid))
 		}
 	}
 }
 
-func (m *Monitor) parseStatFile() {
-	file, err := os.Open("/proc/stat")
+// Ordered returns List in display order, which is "tree order" (see
+// Process.TreeList) when the tree view is enabled, without the processes
+// hidden by the Filter.
+func (m *Monitor) Ordered() []*Process {
+	ordered := m.List
+	if treeFlag {
+		ordered = nil
+		for _, root := range m.Roots() {
+			ordered = append(ordered, root.TreeList(0)...)
+		}
+	}
+	if m.Filter == nil {
+		return ordered
+	}
+
+	var shown []*Process
+	for _, p := range ordered {
+		if !p.hidden {
+			shown = append(shown, p)
+		}
+	}
+	return shown
+}
+
+// CPUPercent returns the CPU usage of p since the last Update, where 100
+// is one CPU.
+func (m *Monitor) CPUPercent(p *Process) float64 {
+	if m.CPUTimeDiff == 0 {
+		return 0
+	}
+	totalUsage := float64(m.CPUTimeDiff)
+	userUsage := 100 * float64(p.UtimeDiff) / totalUsage
+	systemUsage := 100 * float64(p.StimeDiff) / totalUsage
+	return (userUsage + systemUsage) * float64(m.NumCPUs)
+}
+
+// MemPercent returns the share of memory that p has resident.
+func (m *Monitor) MemPercent(p *Process) float64 {
+	if m.MemTotal == 0 {
+		return 0
+	}
+	rssB := p.RSS * m.PageSize
+	return 100 * float64(rssB) / float64(m.MemTotal)
+}
+
+// Roots returns the processes without a Parent, in the order of List.
+func (m *Monitor) Roots() []*Process {
+	var roots []*Process
+	for _, p := range m.List {
+		if p.Parent == nil {
+			roots = append(roots, p)
+		}
+	}
+	return roots
+}
+
+func (m *Monitor) parseStatFile() error {
+	file, err := os.Open(m.procPath("stat"))
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer file.Close()
 
+	var cpu CPUStat
+	var cpus []CPUStat
+
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.HasPrefix(line, "cpu ") {
-			m.CPUTimeTotal = 0
-			cpuTimeValues := strings.Split(line, " ")[2:] // skip "cpu" and ""
-			for _, cpuTimeValue := range cpuTimeValues {
-				m.CPUTimeTotal += MustParseUint64(cpuTimeValue)
-			}
-
-			// Only parsing the CPU jiffies for now, ignore rest of file.
+		if !strings.HasPrefix(line, "cpu") {
+			// The cpu lines come first, ignore the rest of the file.
 			break
 		}
+
+		stat, err := parseCPULine(line)
+		if err != nil {
+			return fmt.Errorf("malformed cpu line in %s: %v", file.Name(), err)
+		}
+		if stat.ID < 0 {
+			cpu = stat
+		} else {
+			cpus = append(cpus, stat)
+		}
 	}
 	if err := scanner.Err(); err != nil {
-		panic(err)
+		return err
+	}
+
+	m.CPUDiff = cpu.Sub(m.CPU)
+	m.CPUsDiff = make([]CPUStat, len(cpus))
+	for i, stat := range cpus {
+		// CPUs may have gone on or offline since the last Update, use
+		// the time since boot for those, like on the first Update.
+		if i < len(m.CPUs) && m.CPUs[i].ID == stat.ID {
+			m.CPUsDiff[i] = stat.Sub(m.CPUs[i])
+		} else {
+			m.CPUsDiff[i] = stat
+		}
 	}
+	m.CPU, m.CPUs = cpu, cpus
+	// The cpu lines are those of the machine ProcRoot was taken from,
+	// which isn't necessarily this one.
+	m.NumCPUs = len(cpus)
+	if m.NumCPUs == 0 {
+		m.NumCPUs = runtime.NumCPU()
+	}
+
+	m.CPUTimeTotal = m.CPU.Total()
+	m.CPUTimeDiff = m.CPUDiff.Total()
+	return nil
 }
 
-func (m *Monitor) parseMeminfoFile() {
-	file, err := os.Open("/proc/meminfo")
+func (m *Monitor) parseMeminfoFile() error {
+	file, err := os.Open(m.procPath("meminfo"))
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "MemTotal:") {
-			// As far as I know this value is always expressed in KB.
-			// line = "MemTotal:       16371752 kB"
-			memKBStr := strings.TrimPrefix(line, "MemTotal:")
-			var memKB uint64
-			_, err := fmt.Sscanf(memKBStr, "%d", &memKB)
-			if err != nil {
-				panic(err)
-			}
-			m.MemTotal = memKB * KB
+	mem, err := parseMeminfo(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file.Name(), err)
+	}
+	m.Mem = mem
+	m.MemTotal = mem.MemTotal
+	return nil
+}
 
-			// Only parsing the MemTotal for now, ignore rest of file.
-			break
+func (m *Monitor) parseLoadavgFile() error {
+	path := m.procPath("loadavg")
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// data = "0.20 0.18 0.12 1/80 11206"
+	values := strings.Fields(string(data))
+	if len(values) < len(m.LoadAvg) {
+		return fmt.Errorf("malformed %s: too few fields", path)
+	}
+	var loadAvg [3]float64
+	for i := range loadAvg {
+		if loadAvg[i], err = strconv.ParseFloat(values[i], 64); err != nil {
+			return fmt.Errorf("malformed %s: %v", path, err)
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		panic(err)
+	m.LoadAvg = loadAvg
+	return nil
+}
+
+func (m *Monitor) parseUptimeFile() error {
+	path := m.procPath("uptime")
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// data = "350735.47 234388.90", the uptime and idle time in seconds.
+	values := strings.Fields(string(data))
+	if len(values) == 0 {
+		return fmt.Errorf("malformed %s: empty", path)
+	}
+	seconds, err := strconv.ParseFloat(values[0], 64)
+	if err != nil {
+		return fmt.Errorf("malformed %s: %v", path, err)
+	}
+	m.Uptime = time.Duration(seconds * float64(time.Second))
+	return nil
+}
+
+func (m *Monitor) readPSI() error {
+	psi, err := readPSI(func(resource string) string {
+		return m.procPath("pressure", resource)
+	})
+	m.PSI = psi
+	if err != nil {
+		return err
+	}
+
+	if m.Cgroup != "" {
+		psi, err = readPSI(func(resource string) string {
+			return filepath.Join(m.Cgroup, resource+".pressure")
+		})
+		m.CgroupPSI = psi
+	}
+	return err
+}
+
+// Rate returns the per second rate of a value that changed by diff since
+// the last Update.
+func (m *Monitor) Rate(diff uint64) float64 {
+	if m.Interval <= 0 {
+		return 0
+	}
+	return float64(diff) / m.Interval.Seconds()
+}
+
+// StateCounts returns the number of processes in each State.
+func (m *Monitor) StateCounts() map[byte]int {
+	counts := make(map[byte]int)
+	for _, p := range m.List {
+		counts[p.State]++
 	}
+	return counts
 }
 
-func (m *Monitor) queryPageSize() {
+func (m *Monitor) queryPageSize() error {
 	out, err := exec.Command("getconf", "PAGESIZE").Output()
 	if err != nil {
-		panic(err)
+		return err
 	}
-	m.PageSize = MustParseUint64(strings.TrimSuffix(string(out), "\n"))
+	m.PageSize, err = ParseUint64(strings.TrimSuffix(string(out), "\n"))
+	return err
 }
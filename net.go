@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpStates are the names of the states in the st column of
+// /proc/net/tcp, see include/net/tcp_states.h.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// A Socket is an entry of /proc/net/{tcp,tcp6,udp,udp6,unix}.
+type Socket struct {
+	Proto  string // tcp, tcp6, udp, udp6 or unix
+	Local  string // address:port, or the path of a unix socket
+	Remote string
+	State  string
+	Inode  uint64
+}
+
+func (s *Socket) String() string {
+	switch {
+	case s.Proto == "unix" && s.Local == "":
+		return "unix (unnamed)"
+	case s.Proto == "unix":
+		return "unix " + s.Local
+	case s.State == "LISTEN" || s.Remote == "":
+		return fmt.Sprintf("%s %s %s", s.Proto, s.Local, s.State)
+	}
+	return fmt.Sprintf("%s %s -> %s %s", s.Proto, s.Local, s.Remote, s.State)
+}
+
+// readSockets returns the sockets of a network namespace by inode. netDir
+// is /proc/<pid>/net for the namespace of a process. Tables that can't be
+// read, like tcp6 without IPv6, are skipped.
+func readSockets(netDir string) map[uint64]*Socket {
+	sockets := make(map[uint64]*Socket)
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		parseInetSockets(filepath.Join(netDir, proto), proto, sockets)
+	}
+	parseUnixSockets(filepath.Join(netDir, "unix"), sockets)
+	return sockets
+}
+
+// parseInetSockets adds the sockets of a tcp or udp table to sockets.
+func parseInetSockets(path, proto string, sockets map[uint64]*Socket) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// "sl local_address rem_address st tx_queue rx_queue tr tm->when
+	// retrnsmt uid timeout inode ..." after a header line
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines[1:] {
+		values := strings.Fields(line)
+		if len(values) < 10 {
+			continue
+		}
+		local, err := parseSocketAddress(values[1])
+		if err != nil {
+			return fmt.Errorf("malformed %s: %v", path, err)
+		}
+		remote, err := parseSocketAddress(values[2])
+		if err != nil {
+			return fmt.Errorf("malformed %s: %v", path, err)
+		}
+		inode, err := ParseUint64(values[9])
+		if err != nil {
+			return fmt.Errorf("malformed %s: %v", path, err)
+		}
+
+		state := tcpStates[values[3]]
+		if strings.HasPrefix(proto, "udp") {
+			// UDP sockets are either connected or not.
+			state = ""
+			if values[3] == "01" {
+				state = "ESTABLISHED"
+			}
+		}
+		if strings.HasSuffix(remote, ":0") {
+			remote = ""
+		}
+
+		sockets[inode] = &Socket{
+			Proto:  proto,
+			Local:  local,
+			Remote: remote,
+			State:  state,
+			Inode:  inode,
+		}
+	}
+	return nil
+}
+
+// parseUnixSockets adds the sockets of a unix table to sockets.
+func parseUnixSockets(path string, sockets map[uint64]*Socket) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// "Num RefCount Protocol Flags Type St Inode Path" after a header line
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines[1:] {
+		values := strings.Fields(line)
+		if len(values) < 7 {
+			continue
+		}
+		inode, err := ParseUint64(values[6])
+		if err != nil {
+			return fmt.Errorf("malformed %s: %v", path, err)
+		}
+		socket := &Socket{Proto: "unix", Inode: inode}
+		if len(values) > 7 {
+			socket.Local = strings.Join(values[7:], " ")
+		}
+		sockets[inode] = socket
+	}
+	return nil
+}
+
+// parseSocketAddress parses an address like "0100007F:1F90" into
+// "127.0.0.1:8080". The address is in groups of four bytes in host byte
+// order, little-endian on the machines jtop runs on, and the port is big
+// endian.
+func parseSocketAddress(s string) (string, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("bad address %q", s)
+	}
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", fmt.Errorf("bad address %q", s)
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("bad port %q", s)
+	}
+
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return net.JoinHostPort(ip.String(), strconv.FormatUint(port, 10)), nil
+}
+
+// A netNamespace is the traffic of a network namespace, read from the
+// net/dev file of a process in it.
+type netNamespace struct {
+	available                bool
+	rxBytes, txBytes         uint64
+	rxBytesDiff, txBytesDiff uint64
+}
+
+// updateNetwork indexes the sockets of every process in SocketPids, counts
+// the established and listening ones and reads the traffic of each network
+// namespace. The socket tables and net/dev are read once per namespace,
+// from the first process found in it.
+func (m *Monitor) updateNetwork() {
+	m.SocketPids = make(map[uint64][]uint64)
+	dirs := make(map[uint64]string)
+
+	for _, p := range m.List {
+		p.SocketsAvailable, p.Established, p.Listening = false, 0, 0
+		p.TrafficAvailable, p.NetNS = false, 0
+		p.NetRxBytesDiff, p.NetTxBytesDiff = 0, 0
+		if p.IsThread() {
+			continue // threads share the files of their process
+		}
+
+		ns, err := readNetNamespace(p.dir)
+		if err != nil {
+			continue
+		}
+		p.NetNS = ns
+		if _, ok := dirs[ns]; !ok {
+			dirs[ns] = p.dir
+		}
+
+		inodes, err := readSocketInodes(p.dir)
+		if err != nil {
+			continue
+		}
+		p.SocketsAvailable = true
+		for _, inode := range inodes {
+			pids := m.SocketPids[inode]
+			// A socket open twice in the same process is counted once.
+			if len(pids) == 0 || pids[len(pids)-1] != p.Pid {
+				m.SocketPids[inode] = append(pids, p.Pid)
+			}
+		}
+	}
+
+	namespaces := make(map[uint64]*netNamespace)
+	for inode, dir := range dirs {
+		ns := &netNamespace{}
+		ns.rxBytes, ns.txBytes, ns.available = parseNetDevFile(filepath.Join(dir, "net", "dev"))
+		if last, ok := m.netNamespaces[inode]; ok && last.available && ns.available {
+			ns.rxBytesDiff = diff(ns.rxBytes, last.rxBytes)
+			ns.txBytesDiff = diff(ns.txBytes, last.txBytes)
+		}
+		namespaces[inode] = ns
+
+		for _, socket := range readSockets(filepath.Join(dir, "net")) {
+			if socket.Proto == "unix" {
+				continue
+			}
+			for _, pid := range m.SocketPids[socket.Inode] {
+				p := m.Map[pid]
+				switch socket.State {
+				case "ESTABLISHED":
+					p.Established++
+				case "LISTEN":
+					p.Listening++
+				}
+			}
+		}
+	}
+	m.netNamespaces = namespaces
+
+	for _, p := range m.List {
+		if ns, ok := namespaces[p.NetNS]; ok && ns.available && !p.IsThread() {
+			p.TrafficAvailable = true
+			p.NetRxBytesDiff, p.NetTxBytesDiff = ns.rxBytesDiff, ns.txBytesDiff
+		}
+	}
+}
+
+// readNetNamespace returns the inode of the network namespace of the
+// process in dir. Like its open files, it can only be read by the owner of
+// the process and root.
+func readNetNamespace(dir string) (uint64, error) {
+	path := filepath.Join(dir, "ns", "net")
+	link, err := os.Readlink(path)
+	if err != nil {
+		return 0, err
+	}
+	var inode uint64
+	if _, err := fmt.Sscanf(link, "net:[%d]", &inode); err != nil {
+		return 0, fmt.Errorf("malformed %s: %q", path, link)
+	}
+	return inode, nil
+}
+
+// readSocketInodes returns the inodes of the sockets among the open files
+// of the process in dir.
+func readSocketInodes(dir string) ([]uint64, error) {
+	fdDir := filepath.Join(dir, "fd")
+	names, err := readDirNames(fdDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var inodes []uint64
+	for _, name := range names {
+		target, err := os.Readlink(filepath.Join(fdDir, name))
+		if err != nil {
+			continue // closed since reading the directory
+		}
+		var inode uint64
+		if _, err := fmt.Sscanf(target, "socket:[%d]", &inode); err == nil {
+			inodes = append(inodes, inode)
+		}
+	}
+	return inodes, nil
+}
+
+// parseNetDevFile returns the bytes received and sent by all interfaces
+// but loopback in a net/dev file, and whether it could be read.
+func parseNetDevFile(path string) (rx, tx uint64, ok bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	// "  eth0: 1234 5 0 0 0 0 0 0 5678 ..." after two header lines, with
+	// the received bytes first and the sent bytes ninth
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 2 {
+		return 0, 0, false
+	}
+	for _, line := range lines[2:] {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		values := strings.Fields(line[i+1:])
+		if strings.TrimSpace(line[:i]) == "lo" || len(values) < 9 {
+			continue
+		}
+		received, err1 := ParseUint64(values[0])
+		sent, err2 := ParseUint64(values[8])
+		if err1 != nil || err2 != nil {
+			return 0, 0, false
+		}
+		rx += received
+		tx += sent
+	}
+	return rx, tx, true
+}
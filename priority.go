@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/nsf/termbox-go"
+)
+
+const (
+	minNice = -20
+	maxNice = 19
+
+	// From linux/ioprio.h
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioMaxLevel   = 7
+)
+
+// The priority operations that priorityError explains failures of.
+const (
+	setNiceOp = iota
+	getIOPriorityOp
+	setIOPriorityOp
+	setRealtimeIOPriorityOp
+)
+
+// IOClasses are the I/O scheduling classes, indexed by their value. Class
+// 0 means none was set and the class is derived from the nice value.
+var IOClasses = []string{"none", "realtime", "best-effort", "idle"}
+
+// HandleNice changes the nice value of the selected process by delta.
+func (ui *UI) HandleNice(delta int) {
+	p := ui.SelectedProcess()
+	if p == nil {
+		return
+	}
+
+	nice := int(p.Nice) + delta
+	if nice < minNice || nice > maxNice {
+		return
+	}
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, int(p.Pid), nice); err != nil {
+		ui.SetError(priorityError(p, setNiceOp, err))
+		return
+	}
+	// Show the new value right away instead of after the next Update.
+	p.Nice = int64(nice)
+	ui.SetMessage(fmt.Sprintf("%v: nice %d", p, nice))
+}
+
+// HandleIOPriority opens the I/O priority menu for the selected process.
+func (ui *UI) HandleIOPriority() {
+	p := ui.SelectedProcess()
+	if p == nil {
+		return
+	}
+	class, level, err := getIOPriority(p.Pid)
+	if err != nil {
+		ui.SetError(priorityError(p, getIOPriorityOp, err))
+		return
+	}
+	if class == 0 {
+		// The effective priority of processes without one is best-effort
+		// with a level derived from the nice value.
+		class, level = 2, int(p.Nice+20)/5
+	}
+	ui.OpenDialog(&ioPriorityMenu{process: p, class: class, level: level})
+}
+
+// ioPriorityMenu is a Dialog to pick the I/O scheduling class and level of
+// a process.
+type ioPriorityMenu struct {
+	process *Process
+	class   int
+	level   int
+}
+
+func (menu *ioPriorityMenu) Draw(ui *UI) {
+	const width = 44
+	height := len(IOClasses) + 4
+	x, y := 2, ui.headerRows()
+
+	ui.unscrolled(func() {
+		ui.drawBox(x, y, width, height, "I/O priority")
+		ui.writeBoxLine(x, width, menu.process.String())
+		ui.writeBoxLine(x, width, "")
+		for class := 1; class < len(IOClasses); class++ {
+			line := IOClasses[class]
+			if class == menu.class {
+				ui.fg, ui.bg = selectedFG, selectedBG
+				if class != 3 {
+					// The idle class has no levels.
+					line += fmt.Sprintf("  < level %d >", menu.level)
+				}
+			}
+			ui.writeBoxLine(x, width, line)
+			ui.fg, ui.bg = dialogFG, dialogBG
+		}
+		ui.writeBoxLine(x, width, "j/k class, h/l level, enter to apply")
+	})
+}
+
+func (menu *ioPriorityMenu) HandleKey(ui *UI, ev termbox.Event) bool {
+	switch {
+	case ev.Ch == 'q' || ev.Key == termbox.KeyEsc:
+		return false
+	case ev.Ch == 'j' || ev.Key == termbox.KeyArrowDown:
+		if menu.class < len(IOClasses)-1 {
+			menu.class++
+		}
+	case ev.Ch == 'k' || ev.Key == termbox.KeyArrowUp:
+		if menu.class > 1 {
+			menu.class--
+		}
+	case ev.Ch == 'h' || ev.Key == termbox.KeyArrowLeft:
+		if menu.level > 0 {
+			menu.level--
+		}
+	case ev.Ch == 'l' || ev.Key == termbox.KeyArrowRight:
+		if menu.level < ioprioMaxLevel {
+			menu.level++
+		}
+	case ev.Key == termbox.KeyEnter:
+		p := menu.process
+		if err := setIOPriority(p.Pid, menu.class, menu.level); err != nil {
+			op := setIOPriorityOp
+			if IOClasses[menu.class] == "realtime" {
+				op = setRealtimeIOPriorityOp
+			}
+			ui.SetError(priorityError(p, op, err))
+		} else {
+			ui.SetMessage(fmt.Sprintf("%v: I/O priority %s %d", p,
+				IOClasses[menu.class], menu.level))
+		}
+		return false
+	}
+	return true
+}
+
+// priorityError explains the usual reason for op failing with err.
+func priorityError(p *Process, op int, err error) error {
+	if err != syscall.EPERM && err != syscall.EACCES {
+		return fmt.Errorf("%v: %v", p, err)
+	}
+
+	var reason string
+	switch {
+	case op == setNiceOp && err == syscall.EACCES:
+		reason = "lowering the nice value requires CAP_SYS_NICE"
+	case op == setNiceOp:
+		reason = "renicing another user's process requires CAP_SYS_NICE"
+	case op == getIOPriorityOp:
+		reason = "the I/O priority of another user's process can't be read"
+	case op == setRealtimeIOPriorityOp:
+		reason = "the realtime I/O class requires CAP_SYS_ADMIN"
+	default:
+		reason = "changing another user's I/O priority requires CAP_SYS_NICE"
+	}
+	return fmt.Errorf("%v: %v (%s)", p, err, reason)
+}
+
+func getIOPriority(pid uint64) (int, int, error) {
+	ioprio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(pid), 0)
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return int(ioprio >> ioprioClassShift), int(ioprio & (1<<ioprioClassShift - 1)), nil
+}
+
+func setIOPriority(pid uint64, class, level int) error {
+	ioprio := class<<ioprioClassShift | level
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(ioprio))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
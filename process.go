@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os/user"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -59,54 +60,112 @@ const (
 // Process represents an operating system process.
 type Process struct {
 	Pid     uint64
+	Tgid    uint64 // Pid of the process a thread belongs to
 	User    *user.User
 	Name    string // foo
 	Command string // /usr/bin/foo --args
 
+	// dir is the /proc/<pid> directory the Process is read from.
+	dir string
+
 	// Alive is a flag used by Monitor to determine if it should remove
 	// this process.
-	Alive bool
+	Alive bool `json:"-"`
+
+	// hidden is set by Monitor if the process doesn't match its Filter.
+	hidden bool
 
 	// Tree view
-	Parent      *Process
-	Children    []*Process
-	TreePrefix  string
+	Parent      *Process   `json:"-"`
+	Children    []*Process `json:"-"`
+	TreePrefix  string     `json:"-"`
 	isLastChild bool
 
 	// Data from /proc/<pid>/stat
-	State byte
-	Ppid  uint64
-	Pgrp  uint64
-	Utime uint64
-	Stime uint64
-	RSS   uint64
+	State    byte
+	Ppid     uint64
+	Pgrp     uint64
+	Utime    uint64
+	Stime    uint64
+	Priority int64
+	Nice     int64
+	RSS      uint64
+
+	// NumThreads is the number of threads and StartTime when the process
+	// started, in jiffies after boot.
+	NumThreads uint64
+	StartTime  uint64
 
 	UtimeDiff uint64
 	StimeDiff uint64
 
+	// Data from /proc/<pid>/io. IOAvailable is false if it can't be read,
+	// usually because the process belongs to another user.
+	IOAvailable         bool
+	ReadBytes           uint64
+	WriteBytes          uint64
+	CancelledWriteBytes uint64
+	Syscr               uint64
+	Syscw               uint64
+
+	ReadBytesDiff           uint64
+	WriteBytesDiff          uint64
+	CancelledWriteBytesDiff uint64
+	SyscrDiff               uint64
+	SyscwDiff               uint64
+
+	// Data from /proc/<pid>/smaps_rollup in bytes, only sampled with the
+	// --smaps option. USS is the memory private to the process.
+	SmapsAvailable bool
+	PSS            uint64
+	USS            uint64
+	Swap           uint64
+	SwapPSS        uint64
+
+	// FDs is the number of open file descriptors, only counted when the
+	// FDS column is shown or sorted by.
+	FDsAvailable bool
+	FDs          uint64
+
+	// Established and Listening count the TCP and UDP sockets of the
+	// process, NetRxBytesDiff and NetTxBytesDiff are the bytes moved by its
+	// network namespace since the last Update. They're only read when one
+	// of the NetColumns is shown or sorted by, see Monitor.updateNetwork.
+	SocketsAvailable bool
+	Established      uint64
+	Listening        uint64
+	TrafficAvailable bool
+	NetNS            uint64
+	NetRxBytesDiff   uint64
+	NetTxBytesDiff   uint64
+
 	initializing bool
 }
 
 // NewProcess returns a new Process if a process is currently running on
-// the system with the passed in Pid.
-func NewProcess(pid uint64) *Process {
+// the system with the passed in Pid. dir is its directory in the proc
+// filesystem. For a thread the Pid is its thread ID and tgid is the Pid of
+// its process, otherwise tgid is the same as pid.
+func NewProcess(dir string, pid, tgid uint64) (*Process, error) {
 	p := &Process{
 		Pid:          pid,
+		Tgid:         tgid,
+		dir:          dir,
 		initializing: true,
 	}
 
 	if err := p.Update(); err != nil {
-		return nil
+		return nil, err
 	}
 
 	if !p.hasEmptyCmdlineFile() {
 		if err := p.parseCmdlineFile(); err != nil {
-			return nil
+			return nil, err
 		}
 	}
 
 	p.initializing = false
-	return p
+	return p, nil
 }
 
 func (p *Process) String() string {
@@ -125,6 +184,10 @@ func (p *Process) Update() error {
 		return err
 	}
 
+	if err := p.parseIOFile(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -133,6 +196,12 @@ func (p *Process) IsKernelThread() bool {
 	return p.Pgrp == 0
 }
 
+// IsThread returns whether or not Process is a thread of another Process.
+func (p *Process) IsThread() bool {
+	// Tgid is zero in recordings from before threads were supported.
+	return p.Tgid != 0 && p.Tgid != p.Pid
+}
+
 // TreeList returns a Process slice in "tree order" such that iterating
 // over it and printing out the TreePrefix and Command will display a
 // nice overview of the process hierarchy.
@@ -154,7 +223,7 @@ func (p *Process) TreeList(level uint) []*Process {
 		p.TreePrefix = end
 	default:
 		p.TreePrefix = ""
-		for parent := p.Parent; parent != nil && parent.Pid != InitPid; parent = parent.Parent {
+		for parent := p.Parent; parent != nil && parent.Parent != nil; parent = parent.Parent {
 			if parent.isLastChild {
 				p.TreePrefix = lastChildSegment + p.TreePrefix
 			} else {
@@ -178,10 +247,8 @@ func (p *Process) TreeList(level uint) []*Process {
 }
 
 func (p *Process) statProcDir() error {
-	path := fmt.Sprintf("/proc/%d", p.Pid)
-
 	var stat syscall.Stat_t
-	if err := syscall.Stat(path, &stat); err != nil {
+	if err := syscall.Stat(p.dir, &stat); err != nil {
 		return err
 	}
 
@@ -195,7 +262,7 @@ func (p *Process) statProcDir() error {
 }
 
 func (p *Process) parseStatFile() error {
-	path := fmt.Sprintf("/proc/%d/stat", p.Pid)
+	path := filepath.Join(p.dir, "stat")
 
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -206,34 +273,82 @@ func (p *Process) parseStatFile() error {
 
 	commStart := strings.IndexByte(line, '(') + 1
 	commEnd := strings.LastIndexByte(line, ')')
-
-	if p.hasEmptyCmdlineFile() {
-		p.Command = line[commStart:commEnd]
-		p.Name = p.Command
+	if commStart == 0 || commEnd < commStart || commEnd+2 > len(line) {
+		return fmt.Errorf("malformed %s: missing comm", path)
 	}
 
 	values := strings.Split(line[commEnd+2:], " ")
+	if len(values) <= statRSS || values[statState] == "" {
+		return fmt.Errorf("malformed %s: too few fields", path)
+	}
+
+	// Parse every field before modifying Process so that a malformed
+	// file leaves the previous values intact.
+	var parseErr error
+	parse := func(i int) uint64 {
+		value, err := ParseUint64(values[i])
+		if err != nil && parseErr == nil {
+			parseErr = fmt.Errorf("malformed %s: %v", path, err)
+		}
+		return value
+	}
+	ppid := parse(statPpid)
+	pgrp := parse(statPgrp)
+	utime := parse(statUtime)
+	stime := parse(statStime)
+	rss := parse(statRSS)
+	numThreads := parse(statNumThreads)
+	startTime := parse(statStartTime)
+	// The priority and nice value can be negative.
+	priority, err := strconv.ParseInt(values[statPriority], 10, 64)
+	if err != nil && parseErr == nil {
+		parseErr = fmt.Errorf("malformed %s: %v", path, err)
+	}
+	nice, err := strconv.ParseInt(values[statNice], 10, 64)
+	if err != nil && parseErr == nil {
+		parseErr = fmt.Errorf("malformed %s: %v", path, err)
+	}
+	if parseErr != nil {
+		return parseErr
+	}
 
 	// One character from the string "RSDZTW" where R
 	// is running, S is sleeping in an interruptible wait,
 	// D is waiting in uninterruptible disk sleep, Z is
 	// zombie, T is traced or stopped (on a signal), and W
-	// is paging.
+	// is paging. See States for the letters of newer kernels.
 	p.State = values[statState][0]
 
-	p.Ppid = MustParseUint64(values[statPpid])
+	p.Ppid = ppid
+
+	p.Pgrp = pgrp
 
-	p.Pgrp = MustParseUint64(values[statPgrp])
+	if p.hasEmptyCmdlineFile() {
+		p.Command = line[commStart:commEnd]
+		p.Name = p.Command
+	}
 
 	lastUtime := p.Utime
-	p.Utime = MustParseUint64(values[statUtime])
+	p.Utime = utime
 	p.UtimeDiff = p.Utime - lastUtime
 
 	lastStime := p.Stime
-	p.Stime = MustParseUint64(values[statStime])
+	p.Stime = stime
 	p.StimeDiff = p.Stime - lastStime
 
-	p.RSS = MustParseUint64(values[statRSS])
+	// A new Process has no previous sample, the difference would be all
+	// of its CPU time and show as a spike.
+	if p.initializing {
+		p.UtimeDiff, p.StimeDiff = 0, 0
+	}
+
+	p.Priority = priority
+	p.Nice = nice
+
+	p.RSS = rss
+
+	p.NumThreads = numThreads
+	p.StartTime = startTime
 
 	// The state will only be running if it's running at the exact
 	// moment this file was read. That's probably not what the
@@ -246,14 +361,125 @@ func (p *Process) parseStatFile() error {
 	return nil
 }
 
-func (p *Process) hasEmptyCmdlineFile() bool {
-	return p.IsKernelThread() || p.State == 'Z'
+// parseIOFile parses /proc/<pid>/io. Failing to read it isn't an error,
+// it's only readable by the owner of the process and root, and doesn't
+// exist without I/O accounting in the kernel.
+func (p *Process) parseIOFile() error {
+	path := filepath.Join(p.dir, "io")
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		p.IOAvailable = false
+		p.ReadBytesDiff, p.WriteBytesDiff, p.CancelledWriteBytesDiff = 0, 0, 0
+		p.SyscrDiff, p.SyscwDiff = 0, 0
+		return nil
+	}
+
+	// data = "rchar: 323934931\nwchar: 323929600\nsyscr: 632687\n..."
+	var readBytes, writeBytes, cancelledWriteBytes, syscr, syscw uint64
+	fields := map[string]*uint64{
+		"read_bytes":            &readBytes,
+		"write_bytes":           &writeBytes,
+		"cancelled_write_bytes": &cancelledWriteBytes,
+		"syscr":                 &syscr,
+		"syscw":                 &syscw,
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		values := strings.Fields(line)
+		if len(values) != 2 {
+			continue
+		}
+		field, ok := fields[strings.TrimSuffix(values[0], ":")]
+		if !ok {
+			continue
+		}
+		if *field, err = ParseUint64(values[1]); err != nil {
+			return fmt.Errorf("malformed %s: %v", path, err)
+		}
+	}
+
+	p.ReadBytesDiff = diff(readBytes, p.ReadBytes)
+	p.WriteBytesDiff = diff(writeBytes, p.WriteBytes)
+	p.CancelledWriteBytesDiff = diff(cancelledWriteBytes, p.CancelledWriteBytes)
+	p.SyscrDiff = diff(syscr, p.Syscr)
+	p.SyscwDiff = diff(syscw, p.Syscw)
+	// Like the CPU time, the first sample only sets the counters.
+	if p.initializing {
+		p.ReadBytesDiff, p.WriteBytesDiff, p.CancelledWriteBytesDiff = 0, 0, 0
+		p.SyscrDiff, p.SyscwDiff = 0, 0
+	}
+
+	p.IOAvailable = true
+	p.ReadBytes = readBytes
+	p.WriteBytes = writeBytes
+	p.CancelledWriteBytes = cancelledWriteBytes
+	p.Syscr = syscr
+	p.Syscw = syscw
+	return nil
 }
 
-func (p *Process) parseCmdlineFile() error {
-	path := fmt.Sprintf("/proc/%d/cmdline", p.Pid)
+// UpdateFDs counts the open file descriptors. FDsAvailable is false if
+// they can't be read, usually because the process belongs to another user.
+func (p *Process) UpdateFDs() {
+	names, err := readDirNames(filepath.Join(p.dir, "fd"))
+	p.FDsAvailable = err == nil
+	p.FDs = uint64(len(names))
+}
+
+// UpdateSmaps updates the PSS, USS, Swap and SwapPSS of Process from
+// /proc/<pid>/smaps_rollup. Reading it walks all mappings of the process,
+// so it's more expensive than Update. As with the io file, failing to read
+// it only makes the values unavailable.
+func (p *Process) UpdateSmaps() error {
+	path := filepath.Join(p.dir, "smaps_rollup")
 
 	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		p.SmapsAvailable = false
+		return nil
+	}
+
+	// data = "...\nPss:                 612 kB\nPrivate_Clean: ..."
+	var pss, privateClean, privateDirty, swap, swapPSS uint64
+	fields := map[string]*uint64{
+		"Pss":           &pss,
+		"Private_Clean": &privateClean,
+		"Private_Dirty": &privateDirty,
+		"Swap":          &swap,
+		"SwapPss":       &swapPSS,
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		values := strings.Fields(line)
+		if len(values) != 3 {
+			continue
+		}
+		field, ok := fields[strings.TrimSuffix(values[0], ":")]
+		if !ok {
+			continue
+		}
+		if *field, err = ParseUint64(values[1]); err != nil {
+			return fmt.Errorf("malformed %s: %v", path, err)
+		}
+		*field *= KB
+	}
+
+	p.SmapsAvailable = true
+	p.PSS = pss
+	p.USS = privateClean + privateDirty
+	p.Swap = swap
+	p.SwapPSS = swapPSS
+	return nil
+}
+
+// hasEmptyCmdlineFile returns whether the command has to be taken from the
+// stat file. Threads share the cmdline of their process, so they're shown
+// with their own name from the stat file instead.
+func (p *Process) hasEmptyCmdlineFile() bool {
+	return p.IsKernelThread() || p.IsThread() || p.State == 'Z'
+}
+
+func (p *Process) parseCmdlineFile() error {
+	data, err := ioutil.ReadFile(filepath.Join(p.dir, "cmdline"))
 	if err != nil {
 		return err
 	}
@@ -283,67 +509,3 @@ func (p ByPid) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
 func (p ByPid) Less(i, j int) bool {
 	return p[i].Pid < p[j].Pid
 }
-
-type ByUser []*Process
-
-func (p ByUser) Len() int      { return len(p) }
-func (p ByUser) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
-func (p ByUser) Less(i, j int) bool {
-	return p[i].User.Username < p[j].User.Username
-}
-
-type ByRSS []*Process
-
-func (p ByRSS) Len() int      { return len(p) }
-func (p ByRSS) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
-func (p ByRSS) Less(i, j int) bool {
-	return p[i].RSS > p[j].RSS
-}
-
-type ByCPU []*Process
-
-func (p ByCPU) Len() int      { return len(p) }
-func (p ByCPU) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
-func (p ByCPU) Less(i, j int) bool {
-	p1, p2 := p[i], p[j]
-	p1Diff := p1.UtimeDiff + p1.StimeDiff
-	p2Diff := p2.UtimeDiff + p2.StimeDiff
-	if p1Diff == p2Diff {
-		return p1.Pid < p2.Pid
-	}
-	return p1Diff > p2Diff
-}
-
-type ByTime []*Process
-
-func (p ByTime) Len() int      { return len(p) }
-func (p ByTime) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
-func (p ByTime) Less(i, j int) bool {
-	p1, p2 := p[i], p[j]
-	p1Total := p1.Utime + p1.Stime
-	p2Total := p2.Utime + p2.Stime
-	if p1Total == p2Total {
-		return p1.Pid < p2.Pid
-	}
-	return p1Total > p2Total
-}
-
-type ByState []*Process
-
-func (p ByState) Len() int      { return len(p) }
-func (p ByState) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
-func (p ByState) Less(i, j int) bool {
-	p1, p2 := p[i], p[j]
-	if p1.State == p2.State {
-		return p1.Pid < p2.Pid
-	}
-	return p1.State < p2.State
-}
-
-type ByName []*Process
-
-func (p ByName) Len() int      { return len(p) }
-func (p ByName) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
-func (p ByName) Less(i, j int) bool {
-	return p[i].Name < p[j].Name
-}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cgroupRoot is where relative --cgroup paths are resolved.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// PressureStat is a line of a pressure file, the share of time in percent
+// that tasks were stalled over the last 10, 60 and 300 seconds and the
+// total stall time in microseconds.
+type PressureStat struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64
+}
+
+// Pressure is the Pressure Stall Information of a resource. Some is the
+// time at least one task was stalled, Full the time all tasks were.
+type Pressure struct {
+	Some    PressureStat
+	Full    PressureStat
+	HasFull bool
+}
+
+// PSI contains the Pressure of each resource. A resource is nil if the
+// kernel doesn't provide information for it.
+type PSI struct {
+	CPU    *Pressure
+	Memory *Pressure
+	IO     *Pressure
+}
+
+// Available returns whether information for any resource is available.
+func (psi PSI) Available() bool {
+	return psi.CPU != nil || psi.Memory != nil || psi.IO != nil
+}
+
+// readPSI reads the pressure files of each resource using path to map a
+// resource name to its file. Resources without a pressure file, because
+// the kernel is older than 4.20 or PSI is disabled, are left nil.
+func readPSI(path func(resource string) string) (PSI, error) {
+	var psi PSI
+	resources := []struct {
+		name     string
+		pressure **Pressure
+	}{
+		{"cpu", &psi.CPU},
+		{"memory", &psi.Memory},
+		{"io", &psi.IO},
+	}
+	for _, resource := range resources {
+		pressure, err := parsePressureFile(path(resource.name))
+		if err != nil && !pressureUnavailable(err) {
+			return psi, err
+		}
+		*resource.pressure = pressure
+	}
+	return psi, nil
+}
+
+func pressureUnavailable(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	return os.IsNotExist(err) || err == syscall.EOPNOTSUPP
+}
+
+func parsePressureFile(path string) (*Pressure, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pressure Pressure
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// line = "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+		values := strings.Fields(scanner.Text())
+		if len(values) == 0 {
+			continue
+		}
+
+		var stat *PressureStat
+		switch values[0] {
+		case "some":
+			stat = &pressure.Some
+		case "full":
+			stat = &pressure.Full
+			pressure.HasFull = true
+		default:
+			continue
+		}
+
+		for _, value := range values[1:] {
+			var err error
+			key, number := splitKeyValue(value)
+			switch key {
+			case "avg10":
+				stat.Avg10, err = strconv.ParseFloat(number, 64)
+			case "avg60":
+				stat.Avg60, err = strconv.ParseFloat(number, 64)
+			case "avg300":
+				stat.Avg300, err = strconv.ParseFloat(number, 64)
+			case "total":
+				stat.Total, err = ParseUint64(number)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("malformed %s: %v", path, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &pressure, nil
+}
+
+func splitKeyValue(s string) (string, string) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+1:]
+}
+
+// cgroupPath resolves a --cgroup path, relative paths are relative to the
+// cgroup v2 mount point.
+func cgroupPath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(cgroupRoot, path)
+}
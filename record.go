@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"time"
+)
+
+// A recording is a gzip compressed stream of Monitors encoded as JSON, one
+// per Update. Every session appends a new gzip member to the file, which
+// gzip readers treat as one continuous stream.
+
+// Recorder appends snapshots of a Monitor to a recording.
+type Recorder struct {
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+// NewRecorder returns a Recorder that appends to the recording at path,
+// creating it if necessary.
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &Recorder{
+		file: file,
+		gz:   gz,
+		enc:  json.NewEncoder(gz),
+	}, nil
+}
+
+// Record appends a snapshot of m. The snapshot is flushed to the file so a
+// recording is usable even if jtop is killed.
+func (r *Recorder) Record(m *Monitor) error {
+	if err := r.enc.Encode(m); err != nil {
+		return err
+	}
+	return r.gz.Flush()
+}
+
+// Close finishes the recording.
+func (r *Recorder) Close() error {
+	if err := r.gz.Close(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+const (
+	minReplaySpeed = 1.0 / 16
+	maxReplaySpeed = 16
+)
+
+// Replay plays back a recording by loading its snapshots into a Monitor.
+type Replay struct {
+	monitor   *Monitor
+	snapshots []*Monitor
+	index     int
+
+	Paused bool
+	Speed  float64
+}
+
+// LoadReplay reads the recording at path.
+func LoadReplay(path string) (*Replay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(gz)
+
+	r := &Replay{
+		monitor: &Monitor{},
+		Speed:   1,
+	}
+	for {
+		m := &Monitor{}
+		if err := dec.Decode(m); err == io.EOF || err == io.ErrUnexpectedEOF {
+			// An unexpected EOF means the recording wasn't closed, keep
+			// the snapshots up to the last one that was flushed.
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		r.snapshots = append(r.snapshots, m)
+	}
+	if len(r.snapshots) == 0 {
+		return nil, fmt.Errorf("%s: recording is empty", path)
+	}
+
+	r.load()
+	return r, nil
+}
+
+// Monitor returns the Monitor that snapshots are loaded into.
+func (r *Replay) Monitor() *Monitor {
+	return r.monitor
+}
+
+// Next loads the next snapshot. It returns false, and pauses, at the end
+// of the recording.
+func (r *Replay) Next() bool {
+	if r.index == len(r.snapshots)-1 {
+		r.Paused = true
+		return false
+	}
+	r.index++
+	r.load()
+	return true
+}
+
+// Prev loads the previous snapshot.
+func (r *Replay) Prev() {
+	if r.index > 0 {
+		r.index--
+		r.load()
+	}
+}
+
+// TogglePause pauses or resumes playback.
+func (r *Replay) TogglePause() {
+	r.Paused = !r.Paused
+}
+
+// Faster doubles the playback speed.
+func (r *Replay) Faster() {
+	if r.Speed < maxReplaySpeed {
+		r.Speed *= 2
+	}
+}
+
+// Slower halves the playback speed.
+func (r *Replay) Slower() {
+	if r.Speed > minReplaySpeed {
+		r.Speed /= 2
+	}
+}
+
+// Wait returns how long to wait before loading the next snapshot, which is
+// the time between the snapshots when they were recorded adjusted for the
+// playback speed.
+func (r *Replay) Wait() time.Duration {
+	wait := delayFlag
+	if r.index < len(r.snapshots)-1 {
+		if recorded := r.snapshots[r.index+1].Time.Sub(r.snapshots[r.index].Time); recorded > 0 {
+			wait = recorded
+		}
+	}
+	return time.Duration(float64(wait) / r.Speed)
+}
+
+// Status describes the position and state of playback.
+func (r *Replay) Status() string {
+	state := "playing"
+	if r.Paused {
+		state = "paused"
+	}
+	return fmt.Sprintf("replay %d/%d %s %s x%g", r.index+1, len(r.snapshots),
+		r.monitor.Time.Format("2006-01-02 15:04:05"), state, r.Speed)
+}
+
+// Reload loads the current snapshot again, e.g. after the threads were
+// toggled.
+func (r *Replay) Reload() {
+	r.load()
+}
+
+// load copies the current snapshot into the Monitor so that the UI, which
+// holds on to the Monitor, draws it.
+func (r *Replay) load() {
+	snapshot := r.snapshots[r.index]
+	filter := r.monitor.Filter
+	*r.monitor = *snapshot
+	r.monitor.Filter = filter
+
+	r.monitor.List = make([]*Process, 0, len(snapshot.List))
+	r.monitor.Map = make(map[uint64]*Process, len(snapshot.List))
+	for _, p := range snapshot.List {
+		if p.IsThread() && !threadsFlag {
+			continue
+		}
+		// Copy each Process because Arrange modifies them.
+		process := *p
+		if process.User == nil {
+			process.User = &user.User{}
+		}
+		r.monitor.List = append(r.monitor.List, &process)
+		r.monitor.Map[process.Pid] = &process
+	}
+	r.monitor.Arrange()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// search is the pattern entered at the '/' prompt. When filtering, only
+// the matching processes are shown, otherwise n and N jump between them.
+type search struct {
+	pattern string
+	regex   bool
+	filter  bool
+
+	// re is the compiled pattern in regex mode, nil if it's invalid.
+	re *regexp.Regexp
+}
+
+// active returns whether there is a pattern to search for.
+func (s *search) active() bool {
+	return s.pattern != "" && (!s.regex || s.re != nil)
+}
+
+// matches returns whether the Name or Command of p matches the pattern.
+// Substrings are matched case-insensitively.
+func (s *search) matches(p *Process) bool {
+	if s.regex {
+		return s.re != nil && (s.re.MatchString(p.Name) || s.re.MatchString(p.Command))
+	}
+	pattern := strings.ToLower(s.pattern)
+	return strings.Contains(strings.ToLower(p.Name), pattern) ||
+		strings.Contains(strings.ToLower(p.Command), pattern)
+}
+
+func (s *search) compile() {
+	s.re = nil
+	if s.regex {
+		s.re, _ = regexp.Compile(s.pattern)
+	}
+}
+
+// searchPrompt is a Dialog on the status bar to edit the search.
+type searchPrompt struct{}
+
+// HandleSearch opens the search prompt.
+func (ui *UI) HandleSearch() {
+	ui.OpenDialog(searchPrompt{})
+}
+
+// HandleClearSearch removes the search pattern, showing all processes.
+func (ui *UI) HandleClearSearch() {
+	selected := ui.SelectedProcess()
+	ui.search = search{filter: true}
+	ui.selectProcess(selected)
+}
+
+// HandleNextMatch selects the next process after the selected one that
+// matches the search, wrapping around at the end. A negative direction
+// searches backwards.
+func (ui *UI) HandleNextMatch(direction int) {
+	if !ui.search.active() {
+		return
+	}
+	processes := ui.processes()
+	n := len(processes)
+	current := ui.start + ui.selected
+	for i := 1; i <= n; i++ {
+		index := ((current+direction*i)%n + n) % n
+		if ui.search.matches(processes[index]) {
+			ui.selectIndex(index)
+			return
+		}
+	}
+	ui.SetMessage("no match for " + ui.search.pattern)
+}
+
+func (searchPrompt) Draw(ui *UI) {
+	ui.y, ui.x = ui.height-footerRows, 0
+	ui.fg, ui.bg = termbox.ColorDefault, termbox.ColorDefault
+
+	s := ui.search
+	mode := "search"
+	if s.filter {
+		mode = "filter"
+	}
+	if s.regex {
+		mode += " regex"
+		if s.re == nil && s.pattern != "" {
+			mode += " (invalid)"
+		}
+	}
+
+	ui.unscrolled(func() {
+		ui.writeString("/" + s.pattern)
+		termbox.SetCursor(ui.x, ui.y)
+		ui.writeString("   ")
+		ui.fg = titleFG | termbox.AttrBold
+		ui.bg = titleBG
+		ui.writeString(" " + mode + " ")
+		ui.fg, ui.bg = termbox.ColorDefault, termbox.ColorDefault
+		ui.writeLastColumn("  tab: filter/search  ^R: regex  enter: done  esc: clear")
+	})
+}
+
+func (searchPrompt) HandleKey(ui *UI, ev termbox.Event) bool {
+	s := &ui.search
+	selected := ui.SelectedProcess()
+
+	switch {
+	case ev.Key == termbox.KeyEsc:
+		termbox.HideCursor()
+		ui.HandleClearSearch()
+		return false
+	case ev.Key == termbox.KeyEnter:
+		termbox.HideCursor()
+		return false
+	case ev.Key == termbox.KeyTab:
+		s.filter = !s.filter
+	case ev.Key == termbox.KeyCtrlR:
+		s.regex = !s.regex
+	case !editLine(&s.pattern, ev):
+		return true
+	}
+	s.compile()
+
+	if s.filter || selected == nil || !s.active() || s.matches(selected) {
+		// Keep the selection where it was, as far as possible.
+		ui.selectProcess(selected)
+	} else {
+		// Jump to the first match as the pattern is typed.
+		ui.HandleNextMatch(1)
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Signals are the signals offered by the signal menu.
+var Signals = []struct {
+	Name   string
+	Signal syscall.Signal
+}{
+	{"SIGTERM", syscall.SIGTERM},
+	{"SIGKILL", syscall.SIGKILL},
+	{"SIGHUP", syscall.SIGHUP},
+	{"SIGINT", syscall.SIGINT},
+	{"SIGQUIT", syscall.SIGQUIT},
+	{"SIGSTOP", syscall.SIGSTOP},
+	{"SIGCONT", syscall.SIGCONT},
+	{"SIGUSR1", syscall.SIGUSR1},
+	{"SIGUSR2", syscall.SIGUSR2},
+}
+
+// signalMenu is a Dialog to pick a signal and confirm sending it to a set
+// of processes.
+type signalMenu struct {
+	targets     []*Process
+	description string
+
+	selected   int
+	confirming bool
+}
+
+// HandleSignal opens the signal menu for the tagged processes, or if none
+// are tagged the selected process, including its descendants in the tree
+// view.
+func (ui *UI) HandleSignal() {
+	menu := &signalMenu{}
+	if tagged := ui.TaggedProcesses(); len(tagged) > 0 {
+		menu.targets = tagged
+		menu.description = fmt.Sprintf("%d tagged processes", len(tagged))
+	} else if p := ui.SelectedProcess(); p == nil {
+		return
+	} else if treeFlag && len(p.Children) > 0 {
+		menu.targets = p.TreeList(0)
+		menu.description = fmt.Sprintf("%v and %d descendants", p, len(menu.targets)-1)
+	} else {
+		menu.targets = []*Process{p}
+		menu.description = p.String()
+	}
+	ui.OpenDialog(menu)
+}
+
+func (menu *signalMenu) Draw(ui *UI) {
+	const width = 44
+	height := len(Signals) + 4
+	x, y := 2, ui.headerRows()
+
+	ui.unscrolled(func() {
+		ui.drawBox(x, y, width, height, "Send signal")
+		ui.writeBoxLine(x, width, menu.description)
+		ui.writeBoxLine(x, width, "")
+		for i, signal := range Signals {
+			line := fmt.Sprintf("%2d %s", int(signal.Signal), signal.Name)
+			if i == menu.selected {
+				ui.fg, ui.bg = selectedFG, selectedBG
+				if menu.confirming {
+					line += "  send? (y/n)"
+				}
+			}
+			ui.writeBoxLine(x, width, line)
+			ui.fg, ui.bg = dialogFG, dialogBG
+		}
+	})
+}
+
+func (menu *signalMenu) HandleKey(ui *UI, ev termbox.Event) bool {
+	if menu.confirming {
+		if ev.Ch == 'y' || ev.Key == termbox.KeyEnter {
+			ui.sendSignal(menu.targets, Signals[menu.selected].Name, Signals[menu.selected].Signal)
+			return false
+		}
+		// Anything else cancels, back to picking a signal.
+		menu.confirming = false
+		return true
+	}
+
+	switch {
+	case ev.Ch == 'q' || ev.Key == termbox.KeyEsc:
+		return false
+	case ev.Ch == 'j' || ev.Key == termbox.KeyArrowDown:
+		if menu.selected < len(Signals)-1 {
+			menu.selected++
+		}
+	case ev.Ch == 'k' || ev.Key == termbox.KeyArrowUp:
+		if menu.selected > 0 {
+			menu.selected--
+		}
+	case ev.Key == termbox.KeyEnter:
+		menu.confirming = true
+	}
+	return true
+}
+
+// sendSignal sends sig to every process and reports the outcome in the
+// status bar.
+func (ui *UI) sendSignal(processes []*Process, name string, sig syscall.Signal) {
+	var failed int
+	var lastErr error
+	for _, p := range processes {
+		if err := syscall.Kill(int(p.Pid), sig); err != nil {
+			failed++
+			lastErr = fmt.Errorf("%v: %v", p, err)
+		}
+	}
+
+	if lastErr != nil {
+		ui.SetError(fmt.Errorf("%s failed for %d of %d processes, last: %v",
+			name, failed, len(processes), lastErr))
+		return
+	}
+	ui.SetMessage(fmt.Sprintf("sent %s to %d processes", name, len(processes)))
+}
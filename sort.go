@@ -0,0 +1,150 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+)
+
+// sortMenu is a Dialog to pick the sort column and the secondary sort
+// column among the shown columns.
+type sortMenu struct {
+	selected int
+}
+
+// HandleSort opens the sort menu at the current sort column.
+func (ui *UI) HandleSort() {
+	menu := &sortMenu{}
+	if i := shownColumnIndex(sortFlag); i >= 0 {
+		menu.selected = i
+	}
+	ui.OpenDialog(menu)
+}
+
+// HandleSortNext sorts by the next shown column, or the previous one if
+// direction is negative.
+func (ui *UI) HandleSortNext(direction int) {
+	n := len(Columns)
+	i := shownColumnIndex(sortFlag)
+	if i < 0 && direction < 0 {
+		i = 0
+	}
+	ui.setSort(Columns[((i+direction)%n+n)%n].Title, false)
+}
+
+// HandleSortReverse inverts the order of the sort column.
+func (ui *UI) HandleSortReverse() {
+	ui.setSort(sortFlag, !SortReverse)
+}
+
+func (ui *UI) setSort(title string, reverse bool) {
+	if title == SecondarySort {
+		SecondarySort = ""
+	}
+	sortFlag, SortReverse = title, reverse
+	ui.rearrange()
+
+	message := "sorted by " + sortFlag
+	if SortReverse {
+		message += ", reversed"
+	}
+	if treeFlag {
+		message += ", once the tree view is off"
+	}
+	ui.SetMessage(message)
+}
+
+// rearrange puts the processes in order again and keeps the selected
+// process on the same row of the screen where possible.
+func (ui *UI) rearrange() {
+	selected := ui.SelectedProcess()
+	row := ui.selected
+	ui.monitor.Arrange()
+
+	processes := ui.processes()
+	for i, p := range processes {
+		if p != selected {
+			continue
+		}
+		ui.start = i - row
+		if last := len(processes) - ui.numProcessesOnScreen(); ui.start > last {
+			ui.start = last
+		}
+		if ui.start < 0 {
+			ui.start = 0
+		}
+		ui.selectIndex(i)
+		return
+	}
+}
+
+// shownColumnIndex returns the index of the column with title in Columns,
+// or -1 if it isn't shown.
+func shownColumnIndex(title string) int {
+	for i, column := range Columns {
+		if column.Title == title {
+			return i
+		}
+	}
+	return -1
+}
+
+func (menu *sortMenu) Draw(ui *UI) {
+	const width = 44
+	height := len(Columns) + 4
+	x, y := 2, ui.headerRows()
+
+	ui.unscrolled(func() {
+		ui.drawBox(x, y, width, height, "Sort by")
+		ui.writeBoxLine(x, width, "enter: sort  s: then by  I: invert")
+		ui.writeBoxLine(x, width, "")
+		for i, column := range Columns {
+			line := "    " + column.Title
+			switch column.Title {
+			case sortFlag:
+				line = " 1  " + column.Title
+				if SortReverse {
+					line += " (reversed)"
+				}
+			case SecondarySort:
+				line = " 2  " + column.Title
+			}
+			if i == menu.selected {
+				ui.fg, ui.bg = selectedFG, selectedBG
+			}
+			ui.writeBoxLine(x, width, line)
+			ui.fg, ui.bg = dialogFG, dialogBG
+		}
+	})
+}
+
+func (menu *sortMenu) HandleKey(ui *UI, ev termbox.Event) bool {
+	if menu.selected >= len(Columns) {
+		menu.selected = len(Columns) - 1
+	}
+	title := Columns[menu.selected].Title
+
+	switch {
+	case ev.Ch == 'q' || ev.Key == termbox.KeyEsc:
+		return false
+	case ev.Ch == 'j' || ev.Key == termbox.KeyArrowDown:
+		if menu.selected < len(Columns)-1 {
+			menu.selected++
+		}
+	case ev.Ch == 'k' || ev.Key == termbox.KeyArrowUp:
+		if menu.selected > 0 {
+			menu.selected--
+		}
+	case ev.Key == termbox.KeyEnter:
+		ui.setSort(title, title == sortFlag && SortReverse)
+		return false
+	case ev.Ch == 'I':
+		ui.HandleSortReverse()
+	case ev.Ch == 's' && title != sortFlag:
+		if SecondarySort == title {
+			SecondarySort = ""
+		} else {
+			SecondarySort = title
+		}
+		ui.rearrange()
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/nsf/termbox-go"
+)
+
+// A Theme is the set of colors used for the process list and the bars
+// around it.
+type Theme struct {
+	TitleFG     termbox.Attribute
+	TitleBG     termbox.Attribute
+	TitleSortBG termbox.Attribute
+
+	SelectedFG termbox.Attribute
+	SelectedBG termbox.Attribute
+
+	ThreadFG termbox.Attribute
+
+	StatusFG termbox.Attribute
+	StatusBG termbox.Attribute
+
+	TaggedFG termbox.Attribute
+}
+
+// Themes are the themes that can be picked with the --theme option.
+var Themes = map[string]Theme{
+	"default": {
+		TitleFG:     termbox.ColorBlack,
+		TitleBG:     termbox.ColorGreen,
+		TitleSortBG: termbox.ColorCyan,
+		SelectedFG:  termbox.ColorBlack,
+		SelectedBG:  termbox.ColorCyan,
+		ThreadFG:    termbox.ColorCyan,
+		StatusFG:    termbox.ColorWhite,
+		StatusBG:    termbox.ColorRed,
+		TaggedFG:    termbox.ColorYellow,
+	},
+	"blue": {
+		TitleFG:     termbox.ColorWhite | termbox.AttrBold,
+		TitleBG:     termbox.ColorBlue,
+		TitleSortBG: termbox.ColorMagenta,
+		SelectedFG:  termbox.ColorBlack,
+		SelectedBG:  termbox.ColorYellow,
+		ThreadFG:    termbox.ColorBlue,
+		StatusFG:    termbox.ColorWhite,
+		StatusBG:    termbox.ColorMagenta,
+		TaggedFG:    termbox.ColorMagenta,
+	},
+	"mono": {
+		TitleFG:     termbox.ColorDefault | termbox.AttrReverse,
+		TitleBG:     termbox.ColorDefault,
+		TitleSortBG: termbox.ColorDefault | termbox.AttrBold,
+		SelectedFG:  termbox.ColorDefault | termbox.AttrReverse | termbox.AttrBold,
+		SelectedBG:  termbox.ColorDefault,
+		ThreadFG:    termbox.ColorDefault,
+		StatusFG:    termbox.ColorDefault | termbox.AttrReverse | termbox.AttrBold,
+		StatusBG:    termbox.ColorDefault,
+		TaggedFG:    termbox.ColorDefault | termbox.AttrUnderline,
+	},
+}
+
+// The colors of the current theme, see useTheme.
+var (
+	titleFG     termbox.Attribute
+	titleBG     termbox.Attribute
+	titleSortBG termbox.Attribute
+
+	selectedFG termbox.Attribute
+	selectedBG termbox.Attribute
+
+	threadFG termbox.Attribute
+
+	statusFG termbox.Attribute
+	statusBG termbox.Attribute
+
+	taggedFG termbox.Attribute
+)
+
+func init() {
+	useTheme(Themes["default"])
+}
+
+func useTheme(theme Theme) {
+	titleFG, titleBG, titleSortBG = theme.TitleFG, theme.TitleBG, theme.TitleSortBG
+	selectedFG, selectedBG = theme.SelectedFG, theme.SelectedBG
+	threadFG = theme.ThreadFG
+	statusFG, statusBG = theme.StatusFG, theme.StatusBG
+	taggedFG = theme.TaggedFG
+}
+
+// themeNames returns the names of the Themes in alphabetical order.
+func themeNames() []string {
+	var names []string
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
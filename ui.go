@@ -2,55 +2,25 @@ package main
 
 import (
 	"fmt"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
 )
 
 const (
-	headerRows = 1
-
-	titleFG     = termbox.ColorBlack
-	titleBG     = termbox.ColorGreen
-	titleSortBG = termbox.ColorCyan
-
-	selectedFG = termbox.ColorBlack
-	selectedBG = termbox.ColorCyan
+	footerRows = 1
 
 	offsetStep = 5
-)
 
-type Column struct {
-	Title      string
-	Width      int
-	RightAlign bool
-}
-
-var (
-	PidColumn        = Column{"PID", 5, true}
-	UserColumn       = Column{"USER", 8, false}
-	RSSColumn        = Column{"RSS", 5, true}
-	MemPercentColumn = Column{"%MEM", 5, true}
-	CPUPercentColumn = Column{"%CPU", 5, true}
-	CPUTimeColumn    = Column{"TIME+", 9, true}
-	StateColumn      = Column{"S", 1, false}
-	CommandColumn    = Column{"COMMAND", -1, false}
-
-	Columns = []Column{
-		PidColumn,
-		UserColumn,
-		RSSColumn,
-		MemPercentColumn,
-		CPUPercentColumn,
-		CPUTimeColumn,
-		StateColumn,
-		CommandColumn,
-	}
+	// messageTimeout is how long a message stays in the status bar.
+	messageTimeout = 5 * time.Second
 )
 
 type UI struct {
 	monitor *Monitor
+	replay  *Replay
 
 	x int
 	y int
@@ -65,11 +35,26 @@ type UI struct {
 
 	width  int
 	height int
+
+	// tagged contains the Pids of the tagged processes.
+	tagged map[uint64]bool
+
+	// dialog is drawn over the process list and receives key presses.
+	dialog Dialog
+
+	search search
+
+	message     string
+	messageErr  bool
+	messageTime time.Time
 }
 
-func NewUI(monitor *Monitor) *UI {
+func NewUI(monitor *Monitor, replay *Replay) *UI {
 	ui := &UI{
 		monitor: monitor,
+		replay:  replay,
+		tagged:  make(map[uint64]bool),
+		search:  search{filter: true},
 	}
 	ui.width, ui.height = termbox.Size()
 	return ui
@@ -81,11 +66,18 @@ func (ui *UI) Draw() {
 	for i, process := range ui.visibleProcesses() {
 		ui.drawProcess(i, process)
 	}
+	ui.drawStatus()
+	if ui.dialog != nil {
+		ui.dialog.Draw(ui)
+	}
 	termbox.Flush()
 }
 
 func (ui *UI) drawHeader() {
 	ui.y, ui.x = 0, 0
+	ui.drawSummary()
+
+	ui.x = 0
 	ui.fg, ui.bg = titleFG, titleBG
 
 	for _, column := range Columns {
@@ -106,79 +98,129 @@ func (ui *UI) drawProcess(i int, process *Process) {
 	ui.fg, ui.bg = termbox.ColorDefault, termbox.ColorDefault
 	if i == ui.selected {
 		ui.fg, ui.bg = selectedFG, selectedBG
+	} else if ui.tagged[process.Pid] {
+		ui.fg = taggedFG
+	}
+	if !ui.search.filter && ui.search.active() && ui.search.matches(process) {
+		ui.fg |= termbox.AttrBold
+	}
+
+	for _, column := range Columns {
+		value := column.Format(ui.monitor, process)
+
+		switch column {
+		case StateColumn:
+			tmpFG := ui.fg
+			if i != ui.selected {
+				switch process.State {
+				case 'R':
+					ui.fg = termbox.ColorGreen
+				}
+			}
+			ui.writeColumn(value, column.Width, column.RightAlign)
+			ui.fg = tmpFG
+		case CommandColumn:
+			if process.IsThread() && i != ui.selected {
+				ui.fg = threadFG
+			}
+			if treeFlag {
+				ui.writeCommandWithPrefix(value, process.TreePrefix)
+			} else {
+				ui.writeLastColumn(value)
+			}
+		default:
+			value = runewidth.Truncate(value, column.Width, "+")
+			ui.writeColumn(value, column.Width, column.RightAlign)
+		}
 	}
 
-	// Pid
-	pid := strconv.FormatUint(process.Pid, 10)
-	ui.writeColumn(pid, PidColumn.Width, PidColumn.RightAlign)
+	ui.y++
+}
 
-	// User
-	user := runewidth.Truncate(process.User.Username, UserColumn.Width, "+")
-	ui.writeColumn(user, UserColumn.Width, UserColumn.RightAlign)
+// drawStatus draws the status bar on the last row, showing the replay
+// position and the most recent sampling error if there has been one.
+func (ui *UI) drawStatus() {
+	ui.y, ui.x = ui.height-footerRows, 0
+	ui.fg, ui.bg = termbox.ColorDefault, termbox.ColorDefault
 
-	// RSS
-	rssB := process.RSS * ui.monitor.PageSize
-	rss := fmt.Sprintf("%dM", rssB/MB)
-	if rssB < MB {
-		if rssB == 0 {
-			// As far as I've seen only kernel threads have 0 RSS.
-			rss = "0"
-		} else {
-			rss = fmt.Sprintf("%dK", rssB/KB)
+	var status []string
+	if ui.replay != nil {
+		ui.fg, ui.bg = titleFG, titleBG
+		status = append(status, ui.replay.Status())
+	}
+	if ui.monitor.Filter != nil {
+		status = append(status, "filter: "+ui.monitor.Filter.String())
+	}
+	if ui.search.active() {
+		mode := "search"
+		if ui.search.filter {
+			mode = "search (filtering)"
 		}
+		status = append(status, mode+": "+ui.search.pattern)
 	}
-	ui.writeColumn(rss, RSSColumn.Width, RSSColumn.RightAlign)
-
-	// Memory Percentage
-	memUsage := 100 * float64(rssB) / float64(ui.monitor.MemTotal)
-	mem := fmt.Sprintf("%.1f", memUsage)
-	ui.writeColumn(mem, MemPercentColumn.Width, MemPercentColumn.RightAlign)
-
-	// CPU Percentage
-	totalUsage := float64(ui.monitor.CPUTimeDiff)
-	userUsage := 100 * float64(process.UtimeDiff) / totalUsage
-	systemUsage := 100 * float64(process.StimeDiff) / totalUsage
-	cpu := fmt.Sprintf("%.1f", (userUsage+systemUsage)*float64(ui.monitor.NumCPUs))
-	ui.writeColumn(cpu, CPUPercentColumn.Width, CPUPercentColumn.RightAlign)
-
-	// CPU Time
-	hertz := uint64(100)
-	// TODO: this has only been tested on my Ubuntu 14.04 system that has
-	// a CLK_TCK of 100. Test on other configurations. (getconf CLK_TCK)
-	totalJiffies := process.Utime + process.Stime
-	totalSeconds := totalJiffies / hertz
-
-	minutes := totalSeconds / 60
-	seconds := totalSeconds % 60
-	hundredths := totalJiffies % hertz
-
-	// FIXME: this won't be pretty when minutes gets big, maybe format hours?
-	time := fmt.Sprintf("%d:%02d:%02d", minutes, seconds, hundredths)
-	ui.writeColumn(time, CPUTimeColumn.Width, CPUTimeColumn.RightAlign)
-
-	// State
-	tmpFG := ui.fg
-	if i != ui.selected {
-		switch process.State {
-		case 'R':
-			ui.fg = termbox.ColorGreen
+	if ui.message != "" && time.Since(ui.messageTime) < messageTimeout {
+		ui.fg, ui.bg = titleFG, titleBG
+		if ui.messageErr {
+			ui.fg, ui.bg = statusFG, statusBG
 		}
+		status = append(status, ui.message)
+	} else if err := ui.monitor.LastErr; err != nil {
+		ui.fg, ui.bg = statusFG, statusBG
+		status = append(status, fmt.Sprintf("%d errors, last: %v", ui.monitor.Errors, err))
 	}
-	ui.writeColumn(string(process.State), StateColumn.Width, StateColumn.RightAlign)
-	ui.fg = tmpFG
 
-	// Command
-	command := process.Name
-	if verboseFlag {
-		command = process.Command
+	// The status bar doesn't scroll horizontally with the process list.
+	ui.unscrolled(func() {
+		ui.writeLastColumn(strings.Join(status, " | "))
+	})
+}
+
+// SetMessage shows a message in the status bar for a few seconds.
+func (ui *UI) SetMessage(message string) {
+	ui.message, ui.messageErr, ui.messageTime = message, false, time.Now()
+}
+
+// SetError shows an error in the status bar for a few seconds.
+func (ui *UI) SetError(err error) {
+	ui.message, ui.messageErr, ui.messageTime = err.Error(), true, time.Now()
+}
+
+// SelectedProcess returns the process under the cursor, or nil if there
+// are no processes.
+func (ui *UI) SelectedProcess() *Process {
+	visible := ui.visibleProcesses()
+	if ui.selected < 0 || ui.selected >= len(visible) {
+		return nil
 	}
-	if treeFlag {
-		ui.writeCommandWithPrefix(command, process.TreePrefix)
-	} else {
-		ui.writeLastColumn(command)
+	return visible[ui.selected]
+}
+
+// TaggedProcesses returns the tagged processes that are still running.
+func (ui *UI) TaggedProcesses() []*Process {
+	var processes []*Process
+	for _, p := range ui.monitor.Ordered() {
+		if ui.tagged[p.Pid] {
+			processes = append(processes, p)
+		}
+	}
+	return processes
+}
+
+// HandleTag tags or untags the selected process and selects the next one.
+func (ui *UI) HandleTag() {
+	if p := ui.SelectedProcess(); p != nil {
+		if ui.tagged[p.Pid] {
+			delete(ui.tagged, p.Pid)
+		} else {
+			ui.tagged[p.Pid] = true
+		}
+		ui.HandleDown()
 	}
+}
 
-	ui.y++
+// HandleUntagAll untags all processes.
+func (ui *UI) HandleUntagAll() {
+	ui.tagged = make(map[uint64]bool)
 }
 
 func (ui *UI) HandleResize(width, height int) {
@@ -227,7 +269,7 @@ func (ui *UI) HandleSelectFirst() {
 }
 
 func (ui *UI) HandleSelectLast() {
-	nProcs := len(ui.monitor.List)
+	nProcs := len(ui.processes())
 	nProcsOnScreen := ui.numProcessesOnScreen()
 	if nProcs < nProcsOnScreen {
 		ui.start = 0
@@ -277,8 +319,9 @@ func (ui *UI) shouldScrollUp() bool {
 }
 
 func (ui *UI) bottomSelected() bool {
-	bottom := len(ui.monitor.List) - 1
-	if len(ui.monitor.List) > ui.numProcessesOnScreen() {
+	nProcs := len(ui.processes())
+	bottom := nProcs - 1
+	if nProcs > ui.numProcessesOnScreen() {
 		// Not all processes fit on the same screen
 		bottom = ui.numProcessesOnScreen() - 1
 	}
@@ -290,28 +333,58 @@ func (ui *UI) topSelected() bool {
 }
 
 func (ui *UI) moreProcessesDown() bool {
-	return len(ui.monitor.List)-ui.start > ui.numProcessesOnScreen()
+	return len(ui.processes())-ui.start > ui.numProcessesOnScreen()
 }
 
 func (ui *UI) moreProcessesUp() bool {
 	return ui.start > 0
 }
 
+// headerRows returns the number of rows above the process list, which are
+// the summary and the column titles.
+func (ui *UI) headerRows() int {
+	return ui.summaryRows() + 1
+}
+
 func (ui *UI) numProcessesOnScreen() int {
-	return ui.height - headerRows
+	if n := ui.height - ui.headerRows() - footerRows; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// processes returns the processes in display order, leaving out those that
+// don't match the search when it's filtering.
+func (ui *UI) processes() []*Process {
+	processes := ui.monitor.Ordered()
+	if !ui.search.filter || !ui.search.active() {
+		return processes
+	}
+	var matches []*Process
+	for _, p := range processes {
+		if ui.search.matches(p) {
+			matches = append(matches, p)
+		}
+	}
+	return matches
 }
 
 func (ui *UI) visibleProcesses() []*Process {
+	processes := ui.processes()
+
 	// Maybe all processes will fit on the same screen
-	end := len(ui.monitor.List)
+	end := len(processes)
+	if end <= ui.numProcessesOnScreen() {
+		ui.start = 0
+	}
 
 	// Maybe they won't
 	if end > ui.numProcessesOnScreen() {
 		end = ui.start + ui.numProcessesOnScreen()
 
 		// Maybe we need to scroll up because some process(es) died
-		if end > len(ui.monitor.List) {
-			diff := end - len(ui.monitor.List)
+		if end > len(processes) {
+			diff := end - len(processes)
 			ui.start -= diff
 			end -= diff
 		}
@@ -319,20 +392,39 @@ func (ui *UI) visibleProcesses() []*Process {
 
 	// When bottom process is selected and a process dies, update selected
 	// to the new bottom process.
-	if ui.selected >= end {
-		ui.selected = end - 1
+	if ui.selected >= end-ui.start {
+		ui.selected = end - ui.start - 1
+	}
+	if ui.selected < 0 {
+		ui.selected = 0
 	}
 
-	if treeFlag {
-		init := ui.monitor.Map[InitPid]
-		treeList := init.TreeList(0)
-		if kernelFlag {
-			kthreadd := ui.monitor.Map[KthreaddPid]
-			treeList = append(treeList, kthreadd.TreeList(0)...)
+	return processes[ui.start:end]
+}
+
+// selectIndex moves the cursor to the process at index of processes,
+// scrolling as little as possible to show it.
+func (ui *UI) selectIndex(index int) {
+	n := ui.numProcessesOnScreen()
+	if index < ui.start {
+		ui.start = index
+	} else if index >= ui.start+n {
+		ui.start = index - n + 1
+	}
+	ui.selected = index - ui.start
+}
+
+// selectProcess moves the cursor to p if it's shown.
+func (ui *UI) selectProcess(p *Process) {
+	if p == nil {
+		return
+	}
+	for i, process := range ui.processes() {
+		if process == p {
+			ui.selectIndex(i)
+			return
 		}
-		return treeList[ui.start:end]
 	}
-	return ui.monitor.List[ui.start:end]
 }
 
 func (ui *UI) writeColumn(s string, columnWidth int, rightAlign bool) {
@@ -378,11 +470,33 @@ func (ui *UI) writeCommandWithPrefix(command, prefix string) {
 	ui.writeLastColumn(command)
 }
 
+// unscrolled calls draw with the horizontal offset disabled, for the parts
+// of the screen that don't scroll with the process list.
+func (ui *UI) unscrolled(draw func()) {
+	offset := ui.offset
+	ui.offset = 0
+	draw()
+	ui.offset = offset
+}
+
 func (ui *UI) setCell(ch rune) {
 	termbox.SetCell(ui.x-(ui.offset*offsetStep), ui.y, ch, ui.fg, ui.bg)
 	ui.x += runewidth.RuneWidth(ch)
 }
 
+// formatMemory formats a number of bytes like the RSS column, "512K" or
+// "120M".
+func formatMemory(b uint64) string {
+	if b < MB {
+		if b == 0 {
+			// As far as I've seen only kernel threads have 0 RSS.
+			return "0"
+		}
+		return fmt.Sprintf("%dK", b/KB)
+	}
+	return fmt.Sprintf("%dM", b/MB)
+}
+
 func bgForTitle(column string) termbox.Attribute {
 	if column == sortFlag {
 		return titleSortBG
@@ -15,29 +15,31 @@ var (
 )
 
 // UserByUid returns a User for a particular Uid. An error will be returned
-// if a User with that Uid does not exist or if the User is not whitelisted.
+// if the User is not whitelisted.
 func UserByUid(uid string) (*user.User, error) {
 	if len(UserWhitelist) == 0 {
-		return userByUid(uid)
+		return userByUid(uid), nil
 	}
 	for _, user := range UserWhitelist {
 		if user.Uid == uid {
-			return userByUid(uid)
+			return userByUid(uid), nil
 		}
 	}
 	return nil, ErrNotWhitelisted
 }
 
-func userByUid(uid string) (*user.User, error) {
-	if user, ok := users[uid]; ok {
-		return user, nil
+// userByUid looks up a User. A Uid without a passwd entry, common with
+// --proc-root pointing at a container or another machine, gets a User
+// named by the number.
+func userByUid(uid string) *user.User {
+	if u, ok := users[uid]; ok {
+		return u
 	}
 
-	user, err := user.LookupId(uid)
+	u, err := user.LookupId(uid)
 	if err != nil {
-		return nil, err
+		u = &user.User{Uid: uid, Username: uid}
 	}
-
-	users[uid] = user
-	return user, nil
+	users[uid] = u
+	return u
 }
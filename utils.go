@@ -6,10 +6,10 @@ func ParseUint64(s string) (uint64, error) {
 	return strconv.ParseUint(s, 10, 64)
 }
 
-func MustParseUint64(s string) uint64 {
-	rv, err := strconv.ParseUint(s, 10, 64)
-	if err != nil {
-		panic(err)
+// diff returns current - last, or zero if the counter went backwards.
+func diff(current, last uint64) uint64 {
+	if current < last {
+		return 0
 	}
-	return rv
+	return current - last
 }